@@ -5,5 +5,10 @@ go 1.13
 require (
 	github.com/go-resty/resty/v2 v2.1.0
 	github.com/hashicorp/go-version v1.2.0
+	github.com/klauspost/compress v1.10.3
+	github.com/klauspost/pgzip v1.2.1
 	github.com/spf13/cobra v0.0.5
+	github.com/spf13/pflag v1.0.3
+	github.com/spf13/viper v1.3.2
+	github.com/ulikunitz/xz v0.5.17
 )
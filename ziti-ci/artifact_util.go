@@ -0,0 +1,455 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	DefaultReleaseDir = "./release"
+
+	DefaultBundleName = "ziti-all"
+
+	BundleModeGlobal    = "global"
+	BundleModePerTarget = "per-target"
+
+	ArchiveFormatZip = "zip"
+	ArchiveFormatTar = "tar"
+)
+
+// knownArchs and knownOses are the GOARCH and GOOS values release dirs are expected to be named after
+var knownArchs = stringSet("386", "amd64", "amd64p32", "arm", "arm64", "loong64", "mips", "mipsle", "mips64", "mips64le",
+	"ppc64", "ppc64le", "riscv64", "s390x", "sparc64", "wasm")
+var knownOses = stringSet("aix", "android", "darwin", "dragonfly", "freebsd", "illumos", "ios", "js", "linux", "netbsd",
+	"openbsd", "plan9", "solaris", "wasip1", "windows")
+
+// archAliases and osAliases map other common names for an arch or os to the GOARCH or GOOS value they are published as
+var archAliases = map[string]string{
+	"x86_64":  "amd64",
+	"x64":     "amd64",
+	"aarch64": "arm64",
+	"i386":    "386",
+	"i686":    "386",
+	"armhf":   "arm",
+	"armv7":   "arm",
+	"armv7l":  "arm",
+}
+var osAliases = map[string]string{
+	"macos": "darwin",
+	"osx":   "darwin",
+	"win":   "windows",
+}
+
+func stringSet(values ...string) map[string]bool {
+	result := map[string]bool{}
+	for _, value := range values {
+		result[value] = true
+	}
+	return result
+}
+
+type artifact struct {
+	name            string
+	artifactArchive string
+	sourceName      string
+	sourcePath      string
+	artifactPath    string
+	checksumPaths   []string
+	sha256          string
+	signaturePath   string
+	cosignSigPath   string
+	cosignCertPath  string
+	sbomPath        string
+	debPath         string
+	rpmPath         string
+	arch            string
+	os              string
+
+	// contents is only set for bundles, and holds the artifacts included in the bundle
+	contents []*artifact
+}
+
+// getGeneratedFiles returns the paths of the archive and any other files generated for the artifact
+func (artifact *artifact) getGeneratedFiles() []string {
+	result := []string{artifact.artifactPath}
+	result = append(result, artifact.checksumPaths...)
+	for _, generatedPath := range []string{artifact.signaturePath, artifact.cosignSigPath, artifact.cosignCertPath, artifact.sbomPath, artifact.debPath, artifact.rpmPath} {
+		if generatedPath != "" {
+			result = append(result, generatedPath)
+		}
+	}
+	return result
+}
+
+// addReleaseFlags registers the flags controlling how the release directory is walked
+func (cmd *baseCommand) addReleaseFlags() {
+	cmd.cmd.PersistentFlags().StringVar(&cmd.releaseDir, "release-dir", DefaultReleaseDir, "set the directory containing the <arch>/<os>/<files> to release")
+	cmd.cmd.PersistentFlags().StringVar(&cmd.outputDir, "output-dir", "", "write archives, checksums and other generated files to <output-dir>/<arch>/<os>, instead of into the release dir")
+	cmd.cmd.PersistentFlags().StringSliceVar(&cmd.checksumAlgorithms, "checksum-algorithms", []string{DefaultChecksumAlgorithm}, "comma separated list of checksum files to generate for each archive. Valid values: [md5, sha256, sha512]")
+	cmd.cmd.PersistentFlags().BoolVar(&cmd.sbom, "sbom", false, "generate a CycloneDX SBOM for each releasable using syft")
+	cmd.cmd.PersistentFlags().StringSliceVar(&cmd.excludeTargets, "exclude-target", nil, "exclude the given arch/os target from publishing. May be specified multiple times")
+	cmd.cmd.PersistentFlags().StringSliceVar(&cmd.expectedTargets, "expected-targets", nil, "fail if the release dir doesn't have artifacts for each of the given arch/os targets. May be specified multiple times")
+	cmd.cmd.PersistentFlags().StringSliceVar(&cmd.platformFilter, "platform-filter", nil, "only publish the given arch/os target. May be specified multiple times. Can't be combined with --exclude-target")
+	cmd.cmd.PersistentFlags().StringSliceVar(&cmd.skipExtensions, "skip-extensions", []string{".zip", ".tar", ".tgz", ".xz"},
+		"comma separated list of file extensions which are never released, in addition to the files ziti-ci generates itself")
+	cmd.cmd.PersistentFlags().Int64Var(&cmd.minArtifactSize, "min-artifact-size", 1, "fail if a releasable file is smaller than the given number of bytes, to catch empty or truncated build output")
+	cmd.cmd.PersistentFlags().StringVar(&cmd.windowsArchive, "windows-archive", ArchiveFormatZip, "set the archive format for windows artifacts. Valid values: [zip, tar]")
+	cmd.cmd.PersistentFlags().BoolVar(&cmd.strict, "strict", false, "fail, instead of warning, if an arch or os dir isn't named after a known GOARCH or GOOS value")
+	cmd.cmd.PersistentFlags().BoolVar(&cmd.recursive, "recursive", false, "also release files in subdirectories of <arch>/<os>, keeping their relative path inside the archive")
+}
+
+// addBundleFlags registers the flags controlling how combined ziti-all bundles are produced
+func (cmd *baseCommand) addBundleFlags() {
+	cmd.cmd.PersistentFlags().StringVar(&cmd.allBundleMode, "all-bundle-mode", BundleModeGlobal,
+		"set how ziti-all bundles are produced. Valid values: [global, per-target]")
+	cmd.cmd.PersistentFlags().BoolVar(&cmd.noAllBundle, "no-all-bundle", false, "don't produce or publish ziti-all bundles")
+	cmd.cmd.PersistentFlags().StringVar(&cmd.bundleName, "bundle-name", DefaultBundleName, "set the name of the bundle archives and the artifactory path they are published under")
+}
+
+// getBundles returns the ziti-all bundles to produce for the given artifacts. In global mode a single bundle holds
+// every artifact. In per-target mode there is one bundle for each arch/os, which only has that target's artifacts.
+// No bundles are returned if bundles are disabled
+func (cmd *baseCommand) getBundles(releaseDir string, artifacts []*artifact) []*artifact {
+	if cmd.noAllBundle {
+		return nil
+	}
+	if cmd.bundleName == "" {
+		cmd.bundleName = DefaultBundleName
+	}
+	outputDir := cmd.getOutputDir(releaseDir)
+
+	if cmd.allBundleMode == "" || cmd.allBundleMode == BundleModeGlobal {
+		archiveName := cmd.bundleName + cmd.archiveExtension()
+		return []*artifact{{
+			name:            cmd.bundleName,
+			artifactArchive: archiveName,
+			artifactPath:    filepath.Join(outputDir, archiveName),
+			contents:        artifacts,
+		}}
+	}
+
+	if cmd.allBundleMode != BundleModePerTarget {
+		cmd.failf("unsupported all bundle mode: '%v'\n", cmd.allBundleMode)
+	}
+
+	var bundles []*artifact
+	bundlesByTarget := map[string]*artifact{}
+	for _, current := range artifacts {
+		target := current.arch + "/" + current.os
+		bundle, found := bundlesByTarget[target]
+		if !found {
+			archiveName := fmt.Sprintf("%v-%v-%v%v", cmd.bundleName, current.os, current.arch, cmd.archiveExtension())
+			bundle = &artifact{
+				name:            cmd.bundleName,
+				artifactArchive: archiveName,
+				artifactPath:    filepath.Join(outputDir, archiveName),
+				arch:            current.arch,
+				os:              current.os,
+			}
+			bundlesByTarget[target] = bundle
+			bundles = append(bundles, bundle)
+		}
+		bundle.contents = append(bundle.contents, current)
+	}
+	return bundles
+}
+
+// getReleaseDir returns the absolute path of the release directory
+func (cmd *baseCommand) getReleaseDir() string {
+	if cmd.releaseDir == "" {
+		cmd.releaseDir = DefaultReleaseDir
+	}
+	releaseDir, err := filepath.Abs(cmd.releaseDir)
+	cmd.exitIfErrf(err, "could not get absolute path for releases directory %v: %v\n", cmd.releaseDir, err)
+	return releaseDir
+}
+
+// getOutputDir returns the absolute path of the directory generated files are written to. Without --output-dir this is
+// the release directory
+func (cmd *baseCommand) getOutputDir(releaseDir string) string {
+	if cmd.outputDir == "" {
+		return releaseDir
+	}
+	outputDir, err := filepath.Abs(cmd.outputDir)
+	cmd.exitIfErrf(err, "could not get absolute path for output directory %v: %v\n", cmd.outputDir, err)
+	return outputDir
+}
+
+// collectArtifacts walks the release directory, which is expected to be laid out as <arch>/<os>/<files>, packaging
+// each releasable file into its own archive
+func (cmd *baseCommand) collectArtifacts(releaseDir string) []*artifact {
+	if cmd.sbom {
+		if _, err := exec.LookPath("syft"); err != nil {
+			cmd.failf("sbom generation requested, but syft was not found on the PATH\n")
+		}
+	}
+
+	if cmd.outputDir != "" {
+		outputDir := cmd.getOutputDir(releaseDir)
+		err := os.MkdirAll(outputDir, 0755)
+		cmd.exitIfErrf(err, "failed to create output dir %v: %v\n", outputDir, err)
+	}
+
+	var artifacts []*artifact
+	for _, artifact := range cmd.findArtifacts(releaseDir) {
+		artifactDir := filepath.Dir(artifact.artifactPath)
+		err := os.MkdirAll(artifactDir, 0755)
+		cmd.exitIfErrf(err, "failed to create output dir %v: %v\n", artifactDir, err)
+
+		// sourceName is relative to the os dir, so files found with --recursive keep their path inside the archive
+		files := map[string]string{artifact.sourcePath: artifact.sourceName}
+		if cmd.sbom {
+			artifact.sbomPath = filepath.Join(artifactDir, artifact.name+".cdx.json")
+			err = cmd.tryRunCommand("generate sbom for "+artifact.sourcePath, "syft", artifact.sourcePath,
+				"-o", "cyclonedx-json", "--file", artifact.sbomPath)
+			if err != nil {
+				cmd.handlePackagingError(artifact, fmt.Errorf("unable to generate sbom. err: %v", err))
+				continue
+			}
+			files[artifact.sbomPath] = filepath.Base(artifact.sbomPath)
+		}
+		cmd.infof("packaging releasable: %v -> %v\n", artifact.sourcePath, artifact.artifactPath)
+		if strings.HasSuffix(artifact.artifactPath, ".zip") {
+			err = cmd.tryZipFiles(artifact.artifactPath, files)
+		} else {
+			err = cmd.tryTarGz(artifact.artifactPath, files, false)
+		}
+		if err != nil {
+			cmd.handlePackagingError(artifact, err)
+			continue
+		}
+		artifact.sha256 = cmd.sha256File(artifact.artifactPath)
+		artifact.checksumPaths = cmd.writeChecksumFiles(artifact.artifactPath)
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts
+}
+
+// handlePackagingError fails, unless --continue-on-packaging-error is set for a snapshot build. Then the artifact is
+// left out and the failure recorded, so the command can fail once everything else is done
+func (cmd *baseCommand) handlePackagingError(artifact *artifact, err error) {
+	if !cmd.continueOnPackagingError || cmd.isReleaseBranch() {
+		cmd.failf("failed to package %v: %v\n", artifact.sourcePath, err)
+	}
+	cmd.errorf("warning: failed to package %v, so leaving it out: %v\n", artifact.sourcePath, err)
+	if removeErr := os.Remove(artifact.artifactPath); removeErr != nil && !os.IsNotExist(removeErr) {
+		cmd.errorf("warning: unable to remove partial archive %v. err: %v\n", artifact.artifactPath, removeErr)
+	}
+	cmd.packagingFailures = append(cmd.packagingFailures, fmt.Sprintf("%v: %v", artifact.sourcePath, err))
+}
+
+// findArtifacts walks the release directory and returns the artifacts which would be produced from it, without
+// packaging them
+func (cmd *baseCommand) findArtifacts(releaseDir string) []*artifact {
+	if cmd.windowsArchive != ArchiveFormatZip && cmd.windowsArchive != ArchiveFormatTar {
+		cmd.failf("unsupported windows archive format: '%v'. Valid values: [%v, %v]\n", cmd.windowsArchive, ArchiveFormatZip, ArchiveFormatTar)
+	}
+	if len(cmd.excludeTargets) > 0 && len(cmd.platformFilter) > 0 {
+		cmd.failf("--exclude-target and --platform-filter can't be used together\n")
+	}
+	excluded := cmd.parseTargets("exclude-target", cmd.excludeTargets)
+	included := cmd.parseTargets("platform-filter", cmd.platformFilter)
+	expected := cmd.parseTargets("expected-targets", cmd.expectedTargets)
+
+	outputDir := cmd.getOutputDir(releaseDir)
+
+	archDirs, err := ioutil.ReadDir(releaseDir)
+	cmd.exitIfErrf(err, "failed to read releases dir: %v\n", err)
+	var artifacts []*artifact
+	// maps each normalized arch/os target to the dir it came from, so aliased dirs can't silently overwrite each other
+	targetDirs := map[string]string{}
+	for _, archDir := range archDirs {
+		archDirPath := filepath.Join(releaseDir, archDir.Name())
+		if archDirPath == outputDir || !archDir.IsDir() {
+			continue
+		}
+		arch := cmd.normalizeTargetDirName("arch", archDir.Name(), knownArchs, archAliases)
+		cmd.infof("processing files for arch: %v\n", arch)
+
+		osDirs, err := ioutil.ReadDir(archDirPath)
+		cmd.exitIfErrf(err, "failed to read arch dir %v: %v\n", archDirPath, err)
+
+		for _, osDir := range osDirs {
+			targetDir := archDir.Name() + "/" + osDir.Name()
+			if !osDir.IsDir() {
+				cmd.errorf("warning: %v is not a directory, so will be ignored\n", targetDir)
+				continue
+			}
+			os := cmd.normalizeTargetDirName("os", osDir.Name(), knownOses, osAliases)
+			if otherDir, found := targetDirs[arch+"/"+os]; found {
+				cmd.failf("release dirs %v and %v would both be published as %v/%v\n", otherDir, targetDir, arch, os)
+			}
+			targetDirs[arch+"/"+os] = targetDir
+
+			if excluded[arch+"/"+os] {
+				cmd.infof("skipping excluded target: %v/%v\n", arch, os)
+				continue
+			}
+			if len(included) > 0 && !included[arch+"/"+os] {
+				cmd.infof("skipping target not matching platform filter: %v/%v\n", arch, os)
+				continue
+			}
+			cmd.infof("processing files for: %v/%v\n", arch, os)
+
+			osDirPath := filepath.Join(archDirPath, osDir.Name())
+			// with --recursive, files in different subdirs can have the same name, and would overwrite each other
+			sourceNames := map[string]string{}
+			for _, sourceName := range cmd.findReleasableFiles(osDirPath) {
+				// only the artifact and archive names drop .exe. The file inside the archive keeps its source name,
+				// so windows users can run ziti.exe directly
+				name := strings.TrimSuffix(filepath.Base(sourceName), ".exe")
+				if otherName, found := sourceNames[name]; found {
+					cmd.failf("%v and %v in %v would both be published as artifact %v\n", otherName, sourceName, targetDir, name)
+				}
+				sourceNames[name] = sourceName
+				archiveName := name + cmd.artifactArchiveExtension(os)
+				artifacts = append(artifacts, &artifact{
+					name:            name,
+					sourceName:      sourceName,
+					sourcePath:      filepath.Join(osDirPath, filepath.FromSlash(sourceName)),
+					artifactArchive: archiveName,
+					artifactPath:    filepath.Join(outputDir, archDir.Name(), osDir.Name(), archiveName),
+					arch:            arch,
+					os:              os,
+				})
+			}
+		}
+	}
+
+	// a matrix build which silently dropped a target shouldn't be published incomplete
+	found := countTargets(artifacts)
+	var missing []string
+	for target := range expected {
+		if found[target] == 0 {
+			missing = append(missing, target)
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		cmd.failf("no artifacts found in %v for expected targets: %v\n", releaseDir, strings.Join(missing, ", "))
+	}
+	return artifacts
+}
+
+// normalizeTargetDirName returns the GOARCH or GOOS value an arch or os dir is published as, mapping common aliases,
+// such as x86_64, to their go name. Unknown names are most likely typos, so are warned about, or fail with --strict
+func (cmd *baseCommand) normalizeTargetDirName(kind string, name string, known map[string]bool, aliases map[string]string) string {
+	if alias := normalizeTargetName(name, aliases); alias != name {
+		cmd.infof("publishing %v dir %v as %v\n", kind, name, alias)
+		return alias
+	}
+	if !known[name] {
+		if cmd.strict {
+			cmd.failf("%v dir %v is not a known go %v name\n", kind, name, kind)
+		}
+		cmd.errorf("warning: %v dir %v is not a known go %v name\n", kind, name, kind)
+	}
+	return name
+}
+
+// findReleasableFiles returns the releasable files in the given os dir, as slash separated paths relative to it.
+// Subdirectories are only searched with --recursive. Fails if any releasable file is smaller than --min-artifact-size
+func (cmd *baseCommand) findReleasableFiles(osDirPath string) []string {
+	var result []string
+	var tooSmall []string
+	err := filepath.Walk(osDirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != osDirPath && !cmd.recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isGeneratedFile(info.Name()) && !cmd.isSkippedFile(info.Name()) {
+			relPath, err := filepath.Rel(osDirPath, path)
+			if err != nil {
+				return err
+			}
+			result = append(result, filepath.ToSlash(relPath))
+			if info.Size() < cmd.minArtifactSize {
+				tooSmall = append(tooSmall, fmt.Sprintf("%v (%v bytes)", path, info.Size()))
+			}
+		}
+		return nil
+	})
+	cmd.exitIfErrf(err, "failed to read os dir %v: %v\n", osDirPath, err)
+	if len(tooSmall) > 0 {
+		cmd.failf("releasable files smaller than the minimum artifact size of %v bytes:\n%v\n", cmd.minArtifactSize, strings.Join(tooSmall, "\n"))
+	}
+	return result
+}
+
+// isSkippedFile returns true if the file has one of the --skip-extensions extensions
+func (cmd *baseCommand) isSkippedFile(fileName string) bool {
+	for _, ext := range cmd.skipExtensions {
+		if ext != "" && strings.HasSuffix(fileName, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGeneratedFile returns true for archives, checksums, signatures and SBOMs, which are produced by packaging rather
+// than being releasable themselves
+func isGeneratedFile(fileName string) bool {
+	if isGeneratedArchive(fileName) || strings.HasSuffix(fileName, ".asc") || strings.HasSuffix(fileName, ".cdx.json") {
+		return true
+	}
+	// cosign signatures and certificates are only generated for archives. Other .sig and .pem files, such as a CA
+	// bundle, may well be releasable
+	for _, ext := range []string{".sig", ".pem"} {
+		if strings.HasSuffix(fileName, ext) && isGeneratedArchive(strings.TrimSuffix(fileName, ext)) {
+			return true
+		}
+	}
+	return isChecksumFile(fileName)
+}
+
+// isGeneratedArchive returns true for the archives and packages produced by packaging
+func isGeneratedArchive(fileName string) bool {
+	for _, ext := range []string{".gz", ".zst", ".xz", ".zip", ".deb", ".rpm"} {
+		if strings.HasSuffix(fileName, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// getArtifactSubPath returns the publish location of an artifact relative to the root of the target repository.
+// Snapshot artifacts are grouped under the branch they were built from
+func (cmd *baseCommand) getArtifactSubPath(artifact *artifact, version string) string {
+	subPath := fmt.Sprintf("%v/%v/%v/%v/%v", artifact.name, artifact.arch, artifact.os, version, artifact.artifactArchive)
+	if !cmd.isReleaseBranch() {
+		subPath = cmd.getCurrentBranch() + "/" + subPath
+	}
+	return subPath
+}
+
+// parseTargets validates that each of the given targets is of the form arch/os and returns them as a set. Aliases are
+// mapped to their go names, so the targets match dirs which were normalized by normalizeTargetDirName
+func (cmd *baseCommand) parseTargets(flagName string, targets []string) map[string]bool {
+	result := map[string]bool{}
+	for _, target := range targets {
+		parts := strings.Split(target, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			cmd.failf("invalid --%v value '%v'. expected format: arch/os\n", flagName, target)
+		}
+		result[normalizeTargetName(parts[0], archAliases)+"/"+normalizeTargetName(parts[1], osAliases)] = true
+	}
+	return result
+}
+
+// normalizeTargetName maps a common alias for an arch or os to its go name
+func normalizeTargetName(name string, aliases map[string]string) string {
+	if alias, found := aliases[name]; found {
+		return alias
+	}
+	return name
+}
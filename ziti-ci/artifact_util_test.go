@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestIsGeneratedFile(t *testing.T) {
+	tests := map[string]bool{
+		"ziti":                 false,
+		"ziti.exe":             false,
+		"ca.pem":               false,
+		"release.sig":          false,
+		"ziti.tar.gz":          true,
+		"ziti.zip":             true,
+		"ziti.tar.gz.sha256":   true,
+		"ziti.tar.gz.asc":      true,
+		"ziti.tar.gz.sig":      true,
+		"ziti.tar.gz.pem":      true,
+		"ziti.zip.sig":         true,
+		"ziti_1.0.0_amd64.deb": true,
+		"ziti.cdx.json":        true,
+	}
+	for fileName, expected := range tests {
+		if actual := isGeneratedFile(fileName); actual != expected {
+			t.Errorf("isGeneratedFile(%v): expected %v, got %v", fileName, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+const (
+	DefaultArtifactoryUrl = "https://netfoundry.jfrog.io/netfoundry"
+	DefaultStagingRepo    = "ziti-staging"
+	DefaultSnapshotRepo   = "ziti-snapshot"
+	DefaultRpmRepo        = "ziti-rpm"
+
+	DefaultStagingPathTemplate  = "{{.Name}}/{{.Arch}}/{{.OS}}/{{.Version}}/{{.Archive}}"
+	DefaultSnapshotPathTemplate = "{{.Branch}}/{{.Name}}/{{.Arch}}/{{.OS}}/{{.Version}}/{{.Archive}}"
+)
+
+// artifactoryCommand holds the connection and repository layout settings shared by commands which work with artifactory
+type artifactoryCommand struct {
+	baseCommand
+	// jfrogAuthFlag is the jfrog-cli flag jfrogAuthSecret is passed with, either --access-token or --apikey
+	jfrogAuthFlag   string
+	jfrogAuthSecret string
+
+	artifactoryUrl string
+	stagingRepo    string
+	snapshotRepo   string
+	rpmRepo        string
+	pathTemplate   string
+	apiKeyFile     string
+
+	compiledPathTemplate *template.Template
+}
+
+// artifactPathFields are the fields available to --path-template
+type artifactPathFields struct {
+	Name    string
+	Arch    string
+	OS      string
+	Version string
+	Branch  string
+	Archive string
+}
+
+func (cmd *artifactoryCommand) addArtifactoryFlags() {
+	cmd.cmd.PersistentFlags().StringVar(&cmd.artifactoryUrl, "artifactory-url", DefaultArtifactoryUrl, "set the artifactory base url")
+	cmd.cmd.PersistentFlags().StringVar(&cmd.stagingRepo, "staging-repo", DefaultStagingRepo, "set the artifactory repository release builds are published to")
+	cmd.cmd.PersistentFlags().StringVar(&cmd.snapshotRepo, "snapshot-repo", DefaultSnapshotRepo, "set the artifactory repository snapshot builds are published to")
+	cmd.cmd.PersistentFlags().StringVar(&cmd.rpmRepo, "rpm-repo", DefaultRpmRepo, "set the artifactory yum repository rpms are published to")
+	cmd.cmd.PersistentFlags().StringVar(&cmd.apiKeyFile, "api-key-file", "", "read the artifactory api key from the given file, if neither the JFROG_ACCESS_TOKEN nor JFROG_API_KEY env vars are set")
+	cmd.cmd.PersistentFlags().StringVar(&cmd.pathTemplate, "path-template", "",
+		"set the go template for artifact paths within the repository, with fields .Name .Arch .OS .Version .Branch .Archive. "+
+			"Defaults to "+DefaultStagingPathTemplate+" for staging and "+DefaultSnapshotPathTemplate+" for snapshot")
+}
+
+// initJfrog resolves the artifactory credentials and installs the jfrog cli. Access tokens are preferred over api
+// keys, which artifactory is deprecating
+func (cmd *artifactoryCommand) initJfrog() {
+	cmd.jfrogAuthFlag = "--apikey"
+
+	var found bool
+	if cmd.jfrogAuthSecret, found = os.LookupEnv("JFROG_ACCESS_TOKEN"); found {
+		cmd.jfrogAuthFlag = "--access-token"
+	} else if cmd.jfrogAuthSecret, found = os.LookupEnv("JFROG_API_KEY"); !found && cmd.apiKeyFile != "" {
+		contents, err := ioutil.ReadFile(cmd.apiKeyFile)
+		if err != nil {
+			cmd.failf("unable to read api key file %v. err: %v\n", cmd.apiKeyFile, err)
+		}
+		cmd.jfrogAuthSecret = strings.TrimRightFunc(string(contents), unicode.IsSpace)
+		found = cmd.jfrogAuthSecret != ""
+		addRedactedSecret(cmd.jfrogAuthSecret)
+	}
+	if !found {
+		cmd.failf("neither JFROG_ACCESS_TOKEN nor JFROG_API_KEY specified\n")
+	}
+	cmd.runCommand("install jfrog cli", "go", "get", "github.com/jfrog/jfrog-cli-go/...")
+}
+
+type artifactorySearchResult struct {
+	Path   string              `json:"path"`
+	Type   string              `json:"type"`
+	Size   int64               `json:"size"`
+	Sha256 string              `json:"sha256"`
+	Props  map[string][]string `json:"props"`
+}
+
+// search returns the artifactory items matching the given pattern and, if not empty, the given props
+func (cmd *artifactoryCommand) search(pattern string, props string) []*artifactorySearchResult {
+	return cmd.searchAt(cmd.artifactoryUrl, pattern, props)
+}
+
+// searchAt searches the artifactory instance at the given url
+func (cmd *artifactoryCommand) searchAt(url string, pattern string, props string) []*artifactorySearchResult {
+	params := []string{"rt", "s", pattern, cmd.jfrogAuthFlag, cmd.jfrogAuthSecret, "--url", url}
+	if props != "" {
+		params = append(params, "--props", props)
+	}
+	output := cmd.runCommandWithOutput("search artifactory", "jfrog", params...)
+
+	var results []*artifactorySearchResult
+	if err := json.Unmarshal([]byte(strings.Join(output, "\n")), &results); err != nil {
+		cmd.failf("unable to parse artifactory search results for %v. err: %v\n", pattern, err)
+	}
+	return results
+}
+
+// isPublished returns true if the given path on the artifactory instance at url already holds a file with the given
+// sha256
+func (cmd *artifactoryCommand) isPublished(url string, dest string, sha256 string) bool {
+	for _, result := range cmd.searchAt(url, dest, "") {
+		if result.Path == dest && result.Sha256 == sha256 {
+			return true
+		}
+	}
+	return false
+}
+
+// getPublishRepo returns the repository artifacts are published to. Release branches publish to staging, all other
+// branches to snapshot
+func (cmd *artifactoryCommand) getPublishRepo() string {
+	if cmd.isReleaseBranch() {
+		return cmd.stagingRepo
+	}
+	return cmd.snapshotRepo
+}
+
+func (cmd *artifactoryCommand) getArtifactDest(artifact *artifact, version string) string {
+	return cmd.getPublishRepo() + "/" + cmd.getArtifactRepoPath(artifact, version)
+}
+
+// getArtifactRepoPath renders the path template for the given artifact. Without --path-template this matches
+// getArtifactSubPath
+func (cmd *artifactoryCommand) getArtifactRepoPath(artifact *artifact, version string) string {
+	if cmd.compiledPathTemplate == nil {
+		templateText := cmd.pathTemplate
+		if templateText == "" {
+			templateText = DefaultSnapshotPathTemplate
+			if cmd.isReleaseBranch() {
+				templateText = DefaultStagingPathTemplate
+			}
+		}
+		compiledTemplate, err := template.New("path").Parse(templateText)
+		if err != nil {
+			cmd.failf("invalid --path-template '%v'. err: %v\n", templateText, err)
+		}
+		cmd.compiledPathTemplate = compiledTemplate
+	}
+
+	fields := &artifactPathFields{
+		Name:    artifact.name,
+		Arch:    artifact.arch,
+		OS:      artifact.os,
+		Version: version,
+		Branch:  cmd.getCurrentBranch(),
+		Archive: artifact.artifactArchive,
+	}
+
+	var result strings.Builder
+	if err := cmd.compiledPathTemplate.Execute(&result, fields); err != nil {
+		cmd.failf("failure executing --path-template for %v. err: %v\n", artifact.sourcePath, err)
+	}
+	return strings.TrimPrefix(result.String(), "/")
+}
+
+// getRpmDest returns the artifactory path for an rpm. Rpms are only published from release branches, and artifactory
+// generates the yum metadata for the repository
+func (cmd *artifactoryCommand) getRpmDest(rpmPath string) string {
+	return fmt.Sprintf("%v/%v", cmd.rpmRepo, filepath.Base(rpmPath))
+}
+
+// getBundleDest returns the artifactory path for a ziti-all bundle. Bundles are only published from release branches
+func (cmd *artifactoryCommand) getBundleDest(bundle *artifact, version string) string {
+	return cmd.stagingRepo + "/" + cmd.getBundleRepoPath(bundle, version)
+}
+
+// getBundleRepoPath returns the path of a ziti-all bundle relative to the root of the repository
+func (cmd *artifactoryCommand) getBundleRepoPath(bundle *artifact, version string) string {
+	if bundle.arch == "" {
+		return fmt.Sprintf("%v/%v/%v.%v%v", bundle.name, version, bundle.name, version, cmd.archiveExtension())
+	}
+	return fmt.Sprintf("%v/%v/%v/%v/%v", bundle.name, bundle.arch, bundle.os, version, bundle.artifactArchive)
+}
+
+// getVersionRootDest returns the artifactory path for files which describe the release as a whole, rather than
+// a single artifact
+func (cmd *artifactoryCommand) getVersionRootDest(version string) string {
+	if cmd.isReleaseBranch() {
+		return fmt.Sprintf("%v/release-info/%v", cmd.stagingRepo, version)
+	}
+	return fmt.Sprintf("%v/%v/release-info/%v", cmd.snapshotRepo, cmd.getCurrentBranch(), version)
+}
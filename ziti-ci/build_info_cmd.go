@@ -37,7 +37,7 @@ type goBuildInfoCmd struct {
 func (cmd *goBuildInfoCmd) execute() {
 	cmd.evalCurrentAndNextVersion()
 
-	tagVersion := fmt.Sprintf("v%v", cmd.nextVersion)
+	tagVersion := cmd.getTagName(cmd.nextVersion.String())
 
 	buildInfo := &GoBuildInfo{
 		PackageName: cmd.args[1],
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// conventionalCommitRegex matches commit subjects of the form type(scope)!: description
+var conventionalCommitRegex = regexp.MustCompile(`^(\w+)(\([^)]*\))?!?:\s*(.+)$`)
+
+// changelogSections are the conventional commit types which get their own section, in output order. Commits of any
+// other type, or which don't follow the convention, are listed under Other
+var changelogSections = []struct {
+	commitType string
+	title      string
+}{
+	{"feat", "Features"},
+	{"fix", "Bug Fixes"},
+	{"chore", "Chores"},
+}
+
+type changelogCmd struct {
+	baseCommand
+	output string
+	since  string
+}
+
+func (cmd *changelogCmd) execute() {
+	// keep stdout clean for the changelog itself
+	if cmd.output == "" {
+		cmd.cmd.SetOut(os.Stderr)
+	}
+
+	cmd.evalCurrentAndNextVersion()
+	publishVersion := cmd.getPublishVersion()
+
+	logParams := []string{"log", "--no-merges", "--pretty=format:%s"}
+	if cmd.since != "" {
+		if !cmd.gitRefExists(cmd.since) {
+			cmd.failf("--since ref %v not found\n", cmd.since)
+		}
+		cmd.infof("generating changelog since %v\n", cmd.since)
+		logParams = append(logParams, cmd.since+"..HEAD")
+	} else if prev := cmd.getPreviousRelease(publishVersion); prev != nil {
+		cmd.infof("generating changelog since %v\n", cmd.getTagName(prev.Original()))
+		logParams = append(logParams, cmd.getTagName(prev.Original())+"..HEAD")
+	} else {
+		cmd.infof("no previous release found, generating changelog from full history\n")
+	}
+
+	subjects := cmd.runCommandWithOutput("list commits", "git", logParams...)
+	changelog := cmd.renderChangelog(cmd.getTagName(publishVersion.String()), subjects)
+
+	if cmd.output == "" {
+		fmt.Print(changelog)
+		return
+	}
+
+	if err := ioutil.WriteFile(cmd.output, []byte(changelog), 0644); err != nil {
+		cmd.failf("unexpected err trying to write changelog to %v. err: %+v\n", cmd.output, err)
+	}
+	cmd.infof("wrote changelog to %v\n", cmd.output)
+}
+
+// getPreviousRelease returns the latest released version before the given version, or nil if there isn't one
+func (cmd *baseCommand) getPreviousRelease(v *version.Version) *version.Version {
+	var result *version.Version
+	for _, tagVersion := range cmd.getVersionList("tag", "--list") {
+		if tagVersion.Prerelease() == "" && tagVersion.LessThan(v) {
+			result = tagVersion
+		}
+	}
+	return result
+}
+
+func (cmd *changelogCmd) renderChangelog(title string, subjects []string) string {
+	grouped := map[string][]string{}
+	var other []string
+
+	for _, subject := range subjects {
+		if match := conventionalCommitRegex.FindStringSubmatch(subject); match != nil {
+			commitType := strings.ToLower(match[1])
+			if isChangelogSection(commitType) {
+				grouped[commitType] = append(grouped[commitType], match[3])
+				continue
+			}
+		}
+		other = append(other, subject)
+	}
+
+	builder := &strings.Builder{}
+	builder.WriteString(fmt.Sprintf("# %v\n", title))
+	for _, section := range changelogSections {
+		writeChangelogSection(builder, section.title, grouped[section.commitType])
+	}
+	writeChangelogSection(builder, "Other", other)
+	return builder.String()
+}
+
+func isChangelogSection(commitType string) bool {
+	for _, section := range changelogSections {
+		if section.commitType == commitType {
+			return true
+		}
+	}
+	return false
+}
+
+func writeChangelogSection(builder *strings.Builder, title string, entries []string) {
+	if len(entries) == 0 {
+		return
+	}
+	builder.WriteString(fmt.Sprintf("\n## %v\n\n", title))
+	for _, entry := range entries {
+		builder.WriteString(fmt.Sprintf("* %v\n", entry))
+	}
+}
+
+func newChangelogCmd(root *rootCommand) *cobra.Command {
+	cobraCmd := &cobra.Command{
+		Use:   "changelog",
+		Short: "Generate a markdown changelog of the commits since the previous release",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	result := &changelogCmd{
+		baseCommand: baseCommand{
+			rootCommand: root,
+			cmd:         cobraCmd,
+		},
+	}
+
+	cobraCmd.PersistentFlags().StringVarP(&result.output, "output", "o", "", "write the changelog to the given file instead of stdout")
+	cobraCmd.PersistentFlags().StringVar(&result.since, "since", "", "tag or sha to generate the changelog from, instead of the previous release")
+
+	return finalize(result)
+}
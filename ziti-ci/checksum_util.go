@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	DefaultChecksumAlgorithm = "sha256"
+	CombinedChecksumsFile    = "SHA256SUMS"
+
+	CombinedChecksumsNone    = "none"
+	CombinedChecksumsAdd     = "add"
+	CombinedChecksumsReplace = "replace"
+)
+
+// checksumAlgorithms are the supported checksum algorithms. Checksum files use the algorithm name as their extension
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+func (cmd *baseCommand) sha256File(filePath string) string {
+	return cmd.digestFile(filePath, "sha256")
+}
+
+func (cmd *baseCommand) digestFile(filePath string, algorithm string) string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		cmd.failf("unexpected err trying to open file %v. err: %+v\n", filePath, err)
+	}
+	defer cmd.close(file, "checksum source file "+filePath)
+
+	digest := checksumAlgorithms[algorithm]()
+	if _, err = io.Copy(digest, file); err != nil {
+		cmd.failf("unexpected err trying to compute checksum for %v. err: %+v\n", filePath, err)
+	}
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+// validateChecksumAlgorithms fails if any of the requested checksum algorithms is not supported
+func (cmd *baseCommand) validateChecksumAlgorithms() {
+	for _, algorithm := range cmd.checksumAlgorithms {
+		if _, found := checksumAlgorithms[algorithm]; !found {
+			var supported []string
+			for name := range checksumAlgorithms {
+				supported = append(supported, name)
+			}
+			sort.Strings(supported)
+			cmd.failf("unsupported checksum algorithm: '%v'. Valid values: [%v]\n", algorithm, strings.Join(supported, ", "))
+		}
+	}
+}
+
+// writeChecksumFiles writes a checksum file next to the given file for each requested algorithm, and returns their paths
+func (cmd *baseCommand) writeChecksumFiles(filePath string) []string {
+	var result []string
+	for _, algorithm := range cmd.checksumAlgorithms {
+		result = append(result, cmd.writeChecksumFile(filePath, "."+algorithm, cmd.digestFile(filePath, algorithm)))
+	}
+	return result
+}
+
+// writeChecksumFile writes a checksum file in the format expected by sha256sum -c, md5sum -c, etc, and returns its path
+func (cmd *baseCommand) writeChecksumFile(filePath string, extension string, digest string) string {
+	checksumPath := filePath + extension
+	_, fileName := filepath.Split(filePath)
+	contents := fmt.Sprintf("%v  %v\n", digest, fileName)
+	if err := ioutil.WriteFile(checksumPath, []byte(contents), 0644); err != nil {
+		cmd.failf("unexpected err trying to write checksum file %v. err: %+v\n", checksumPath, err)
+	}
+	return checksumPath
+}
+
+// writeCombinedChecksumsFile writes a single sha256sum -c compatible file covering all the given files. digests maps
+// the path each file is listed under to its sha256
+func (cmd *baseCommand) writeCombinedChecksumsFile(checksumsPath string, digests map[string]string) {
+	var names []string
+	for name := range digests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var contents strings.Builder
+	for _, name := range names {
+		contents.WriteString(fmt.Sprintf("%v  %v\n", digests[name], name))
+	}
+	if err := ioutil.WriteFile(checksumsPath, []byte(contents.String()), 0644); err != nil {
+		cmd.failf("unexpected err trying to write checksums file %v. err: %+v\n", checksumsPath, err)
+	}
+}
+
+func isChecksumFile(fileName string) bool {
+	_, found := checksumAlgorithms[strings.TrimPrefix(filepath.Ext(fileName), ".")]
+	return found
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ciProvider describes how to detect a CI environment and where it exposes branch and build information. See the
+// README for the env vars used by each supported provider
+type ciProvider struct {
+	name string
+
+	// detectEnvVar is set when running under this provider. If detectValue is not empty, the env var must also match it
+	detectEnvVar string
+	detectValue  string
+
+	// branchEnvVars are checked in order, the first non-empty value is used as the branch name
+	branchEnvVars []string
+	// branchPrefix is stripped from the branch name, for providers which include the remote name
+	branchPrefix      string
+	buildNumberEnvVar string
+	// runIdEnvVar uniquely identifies the CI run, unlike the build number which may be reused across workflows
+	runIdEnvVar string
+}
+
+var ciProviders = []*ciProvider{
+	{
+		name:              "github-actions",
+		detectEnvVar:      "GITHUB_ACTIONS",
+		detectValue:       "true",
+		branchEnvVars:     []string{"GITHUB_HEAD_REF", "GITHUB_REF_NAME"},
+		buildNumberEnvVar: "GITHUB_RUN_NUMBER",
+		runIdEnvVar:       "GITHUB_RUN_ID",
+	},
+	{
+		name:              "gitlab",
+		detectEnvVar:      "GITLAB_CI",
+		branchEnvVars:     []string{"CI_COMMIT_REF_NAME"},
+		buildNumberEnvVar: "CI_PIPELINE_IID",
+		runIdEnvVar:       "CI_PIPELINE_ID",
+	},
+	{
+		name:              "travis",
+		detectEnvVar:      "TRAVIS",
+		detectValue:       "true",
+		branchEnvVars:     []string{"TRAVIS_PULL_REQUEST_BRANCH", "TRAVIS_BRANCH"},
+		buildNumberEnvVar: "TRAVIS_BUILD_NUMBER",
+		runIdEnvVar:       "TRAVIS_BUILD_ID",
+	},
+	{
+		name:              "bitbucket",
+		detectEnvVar:      "BITBUCKET_PIPELINE_UUID",
+		branchEnvVars:     []string{"BITBUCKET_BRANCH"},
+		buildNumberEnvVar: "BITBUCKET_BUILD_NUMBER",
+		runIdEnvVar:       "BITBUCKET_PIPELINE_UUID",
+	},
+	{
+		name:              "jenkins",
+		detectEnvVar:      "JENKINS_URL",
+		branchEnvVars:     []string{"GIT_BRANCH"},
+		branchPrefix:      "origin/",
+		buildNumberEnvVar: "BUILD_NUMBER",
+		runIdEnvVar:       "BUILD_TAG",
+	},
+}
+
+func (provider *ciProvider) isActive() bool {
+	val, found := os.LookupEnv(provider.detectEnvVar)
+	if provider.detectValue == "" {
+		return found && val != ""
+	}
+	return val == provider.detectValue
+}
+
+func (provider *ciProvider) getBranch() string {
+	for _, envVar := range provider.branchEnvVars {
+		if val, found := os.LookupEnv(envVar); found && val != "" {
+			return strings.TrimPrefix(val, provider.branchPrefix)
+		}
+	}
+	return ""
+}
+
+func (provider *ciProvider) getBuildNumber() string {
+	if val, found := os.LookupEnv(provider.buildNumberEnvVar); found && val != "" {
+		return val
+	}
+	return ""
+}
+
+func (provider *ciProvider) getRunId() string {
+	if val, found := os.LookupEnv(provider.runIdEnvVar); found && val != "" {
+		return val
+	}
+	return ""
+}
+
+// getCiProvider returns the CI environment we're running in, or nil if none of the supported providers is detected
+func (cmd *baseCommand) getCiProvider() *ciProvider {
+	for _, provider := range ciProviders {
+		if provider.isActive() {
+			return provider
+		}
+	}
+	return nil
+}
+
+// writeGithubOutputs appends the given outputs to the $GITHUB_OUTPUT file, so later steps of a GitHub Actions job can
+// use them. Outside of GitHub Actions this does nothing
+func (cmd *baseCommand) writeGithubOutputs(outputs [][2]string) {
+	outputFile, found := os.LookupEnv("GITHUB_OUTPUT")
+	if !found || outputFile == "" {
+		return
+	}
+
+	file, err := os.OpenFile(outputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		cmd.failf("unable to open github output file %v. err: %v\n", outputFile, err)
+	}
+	defer cmd.close(file, "github output file "+outputFile)
+
+	for _, output := range outputs {
+		if _, err = fmt.Fprintf(file, "%v=%v\n", output[0], output[1]); err != nil {
+			cmd.failf("unable to write github output file %v. err: %v\n", outputFile, err)
+		}
+	}
+}
@@ -2,22 +2,46 @@ package main
 
 import (
 	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/hashicorp/go-version"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
 	"github.com/spf13/cobra"
+	"github.com/ulikunitz/xz"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// dryRunSkippedCommands are the external commands which publish or otherwise modify remote state, and so are not
+// executed when doing a dry run
+var dryRunSkippedCommands = map[string]bool{
+	"jfrog":  true,
+	"aws":    true,
+	"docker": true,
+	"cosign": true,
+	"az":     true,
+	"gcloud": true,
+}
+
 type ciCmd interface {
 	getCobraCmd() *cobra.Command
 	init(args []string)
@@ -37,31 +61,79 @@ type baseCommand struct {
 
 	cmd  *cobra.Command
 	args []string
+	ctx  context.Context
 
 	baseVersion    *version.Version
 	currentVersion *version.Version
 	nextVersion    *version.Version
 
-	currentBranch *string
-	buildNumber   *string
-}
+	currentBranch      *string
+	buildNumber        *string
+	releaseBranchRegex *regexp.Regexp
+
+	// logPrefix is prepended to each logged line, to identify the artifact a worker is logging about
+	logPrefix string
+
+	releaseDir         string
+	outputDir          string
+	excludeTargets     []string
+	platformFilter     []string
+	expectedTargets    []string
+	strict             bool
+	allowDirty         bool
+	recursive          bool
+	windowsArchive     string
+	minArtifactSize    int64
+	skipExtensions     []string
+	checksumAlgorithms []string
+	sbom               bool
+	allBundleMode      string
+	noAllBundle        bool
+	bundleName         string
+
+	continueOnPackagingError bool
+	packagingFailures        []string
+}
+
+// failHook, if set, is run once by failf before exiting, e.g. to publish the log of a failed publish. Parallel workers
+// which fail while it runs wait for it to finish before exiting, so the hook must not call failf itself
+var failHook func()
+var failHookOnce sync.Once
 
 func (cmd *baseCommand) failf(format string, params ...interface{}) {
-	_, _ = fmt.Fprintf(cmd.cmd.ErrOrStderr(), format, params...)
+	if cmd.ctx != nil && cmd.ctx.Err() == context.DeadlineExceeded {
+		cmd.logf(cmd.cmd.ErrOrStderr(), "fatal", "timed out after %v\n", cmd.timeout)
+	}
+	cmd.logf(cmd.cmd.ErrOrStderr(), "fatal", format, params...)
+	failHookOnce.Do(func() {
+		if failHook != nil {
+			failHook()
+		}
+	})
 	os.Exit(-1)
 }
 
 func (cmd *baseCommand) infof(format string, params ...interface{}) {
-	_, _ = fmt.Fprintf(cmd.cmd.OutOrStdout(), format, params...)
+	out := cmd.cmd.OutOrStdout()
+	if cmd.quiet {
+		// quiet messages are still captured, so a captured log keeps the full detail
+		out = ioutil.Discard
+	}
+	cmd.logf(out, "info", format, params...)
+}
+
+// summaryf logs the outcome of a command. Unlike infof, it is still shown in quiet mode
+func (cmd *baseCommand) summaryf(format string, params ...interface{}) {
+	cmd.logf(cmd.cmd.OutOrStdout(), "info", format, params...)
 }
 
 func (cmd *baseCommand) errorf(format string, params ...interface{}) {
-	_, _ = fmt.Fprintf(cmd.cmd.OutOrStderr(), format, params...)
+	cmd.logf(cmd.cmd.OutOrStderr(), "error", format, params...)
 }
 
 func (cmd *baseCommand) exitIfErrf(err error, format string, params ...interface{}) {
 	if err != nil {
-		cmd.failf(format, params)
+		cmd.failf(format, params...)
 	}
 }
 
@@ -70,12 +142,30 @@ func (cmd *baseCommand) isGoLang() bool {
 }
 
 func (cmd *baseCommand) getPublishVersion() *version.Version {
-	if cmd.currentVersion == nil {
+	if cmd.currentVersion == nil || cmd.prerelease != "" {
 		return cmd.nextVersion
 	}
 	return cmd.currentVersion
 }
 
+// getArtifactVersion returns the version to publish artifacts under. Builds from non-release branches get the build
+// number appended, so that snapshots don't collide, unless it is already part of a prerelease version or the version
+// was given explicitly
+func (cmd *baseCommand) getArtifactVersion() string {
+	// When rolling minor/major numbers the current version will be nil, so use the next version instead
+	// This will only happen when publishing a PR
+	version := cmd.getPublishVersion().String()
+	if !cmd.isReleaseBranch() && cmd.prerelease == "" && cmd.versionOverride == "" {
+		version = fmt.Sprintf("%v-%v", version, cmd.getBuildNumber())
+	}
+	return version
+}
+
+// getTagName renders the given version as a tag or release name, using the configured version prefix
+func (cmd *baseCommand) getTagName(version string) string {
+	return cmd.versionPrefix + version
+}
+
 func (cmd *baseCommand) setLangType() {
 	if cmd.langName == "" {
 		return
@@ -87,10 +177,75 @@ func (cmd *baseCommand) setLangType() {
 	}
 }
 
+func (cmd *baseCommand) validateCompression() {
+	if cmd.compression != CompressionGzip && cmd.compression != CompressionZstd && cmd.compression != CompressionXz {
+		cmd.failf("unsupported compression: '%v'\n", cmd.compression)
+	}
+	if cmd.compressionLevel != 0 && cmd.compression != CompressionGzip {
+		cmd.failf("--compression-level only applies to gzip compression, not %v\n", cmd.compression)
+	}
+	if cmd.compressionLevel != 0 && (cmd.compressionLevel < gzip.BestSpeed || cmd.compressionLevel > gzip.BestCompression) {
+		cmd.failf("unsupported compression level: %v. Must be between %v and %v\n", cmd.compressionLevel, gzip.BestSpeed, gzip.BestCompression)
+	}
+}
+
 func (cmd *baseCommand) init(args []string) {
 	cmd.args = args
+	cmd.loadConfig()
+	cmd.validateLogFormat()
+	cmd.initTimeout()
 	cmd.setLangType()
-	cmd.baseVersion = cmd.getBaseVersion()
+	cmd.validateCompression()
+	cmd.validateVersionScheme()
+	cmd.validateChecksumAlgorithms()
+	cmd.validateBuildNumberOverride()
+	cmd.validateReleaseBranchPattern()
+	if cmd.versionOverride != "" && cmd.prerelease != "" {
+		cmd.failf("version override and prerelease may not both be specified\n")
+	}
+	cmd.validateVersionSource()
+	if !cmd.isCalVer() && cmd.versionSource == VersionSourceGit {
+		cmd.baseVersion = cmd.getBaseVersion()
+	}
+}
+
+func (cmd *baseCommand) validateVersionSource() {
+	if cmd.versionSource != VersionSourceGit && cmd.versionSource != VersionSourceFile {
+		cmd.failf("unsupported version source: '%v'. Valid values: [%v, %v]\n", cmd.versionSource, VersionSourceGit, VersionSourceFile)
+	}
+	if cmd.versionSource == VersionSourceFile && cmd.isCalVer() {
+		cmd.failf("the %v version source may not be used with the %v version scheme\n", VersionSourceFile, VersionSchemeCalVer)
+	}
+}
+
+// initTimeout sets up the context external commands are run under. If a timeout is set, running commands are killed
+// and ziti-ci exits once it expires
+func (cmd *baseCommand) initTimeout() {
+	cmd.ctx = context.Background()
+	if cmd.timeout <= 0 {
+		return
+	}
+
+	var cancel context.CancelFunc
+	cmd.ctx, cancel = context.WithTimeout(cmd.ctx, cmd.timeout)
+	go func() {
+		defer cancel()
+		<-cmd.ctx.Done()
+		cmd.failf("stopping %v\n", cmd.cmd.Name())
+	}()
+}
+
+func (cmd *baseCommand) validateVersionScheme() {
+	if cmd.versionScheme != VersionSchemeSemVer && cmd.versionScheme != VersionSchemeCalVer {
+		cmd.failf("unsupported version scheme: '%v'\n", cmd.versionScheme)
+	}
+	if cmd.isCalVer() && cmd.baseVersionString != "" {
+		cmd.failf("base version may not be specified when using the %v version scheme\n", VersionSchemeCalVer)
+	}
+}
+
+func (cmd *baseCommand) isCalVer() bool {
+	return cmd.versionScheme == VersionSchemeCalVer
 }
 
 func (cmd *baseCommand) getCobraCmd() *cobra.Command {
@@ -98,8 +253,46 @@ func (cmd *baseCommand) getCobraCmd() *cobra.Command {
 }
 
 func (cmd *baseCommand) evalCurrentAndNextVersion() {
+	if cmd.versionOverride != "" {
+		v, err := version.NewSemver(cmd.versionOverride)
+		if err != nil {
+			cmd.failf("invalid version override '%v'. err: %+v\n", cmd.versionOverride, err)
+		}
+		cmd.currentVersion, cmd.nextVersion = v, v
+		cmd.infof("using version override: %v\n", v)
+		return
+	}
+
+	if cmd.versionSource == VersionSourceFile {
+		contents, err := ioutil.ReadFile(cmd.versionSourceFile)
+		if err != nil {
+			cmd.failf("unable to read version from %v. err: %+v\n", cmd.versionSourceFile, err)
+		}
+		v, err := version.NewSemver(strings.TrimSpace(string(contents)))
+		if err != nil {
+			cmd.failf("invalid version in %v. err: %+v\n", cmd.versionSourceFile, err)
+		}
+		cmd.currentVersion, cmd.nextVersion = v, v
+		cmd.applyPrerelease()
+		cmd.infof("using version from %v: %v\n", cmd.versionSourceFile, v)
+		return
+	}
+
 	cmd.runGitCommandAlways("fetching git tags", "fetch", "--tags")
-	versions := cmd.getVersionList("tag", "--list")
+	var versions []*version.Version
+	for _, v := range cmd.getVersionList("tag", "--list") {
+		// prerelease tags don't count as releases, otherwise an rc tag would cause its own version to be skipped
+		if v.Prerelease() == "" {
+			versions = append(versions, v)
+		}
+	}
+
+	if cmd.isCalVer() {
+		cmd.currentVersion, cmd.nextVersion = getCalVersions(time.Now().UTC(), versions)
+		cmd.applyPrerelease()
+		cmd.infof("current version: %v, next version: %v\n", cmd.currentVersion, cmd.nextVersion)
+		return
+	}
 
 	min := setPatch(cmd.baseVersion, 0)
 	max := getNext(Minor, min)
@@ -125,7 +318,22 @@ func (cmd *baseCommand) evalCurrentAndNextVersion() {
 	if cmd.nextVersion.LessThan(cmd.baseVersion) {
 		cmd.nextVersion = cmd.baseVersion
 	}
-	fmt.Printf("current version: %v, next version: %v\n", cmd.currentVersion, cmd.nextVersion)
+	cmd.applyPrerelease()
+	cmd.infof("current version: %v, next version: %v\n", cmd.currentVersion, cmd.nextVersion)
+}
+
+// applyPrerelease marks the next version as a prerelease of itself, using the build number to distinguish successive
+// prereleases, e.g. 1.3.0-rc.12
+func (cmd *baseCommand) applyPrerelease() {
+	if cmd.prerelease == "" {
+		return
+	}
+	versionString := fmt.Sprintf("%v-%v.%v", cmd.nextVersion, cmd.prerelease, cmd.getBuildNumber())
+	v, err := version.NewVersion(versionString)
+	if err != nil {
+		cmd.failf("invalid prerelease version %v. err: %+v\n", versionString, err)
+	}
+	cmd.nextVersion = v
 }
 
 func (cmd *baseCommand) runGitCommand(description string, params ...string) {
@@ -137,17 +345,89 @@ func (cmd *baseCommand) runGitCommandAlways(description string, params ...string
 }
 
 func (cmd *baseCommand) runGitCommandOptional(description string, dryRun bool, params ...string) {
-	cmd.infof("%v: git %v \n", description, strings.Join(params, " "))
+	cmd.logCommand(description, "git", params...)
 	if !dryRun {
-		gitCmd := exec.Command("git", params...)
+		gitCmd := exec.CommandContext(cmd.ctx, "git", params...)
 		gitCmd.Stderr = os.Stderr
-		gitCmd.Stdout = os.Stdout
+		gitCmd.Stdout = cmd.cmd.OutOrStdout()
 		if err := gitCmd.Run(); err != nil {
 			cmd.failf("error %v: %v\n", description, err)
 		}
 	}
 }
 
+// DefaultGitRetryDelay is the delay before the first retry of a git push. It doubles with each subsequent retry
+const DefaultGitRetryDelay = 2 * time.Second
+
+// gitNetworkErrors are the git error messages which indicate a transient problem talking to the remote, rather than
+// a problem with the push itself
+var gitNetworkErrors = []string{
+	"could not resolve host",
+	"connection timed out",
+	"connection reset",
+	"connection refused",
+	"failed to connect",
+	"operation timed out",
+	"the remote end hung up unexpectedly",
+	"early eof",
+	"rpc failed",
+	"gnutls_handshake",
+	"returned error: 5",
+	"http 5",
+}
+
+// isGitNetworkError returns true if the git command failed talking to the remote, so is worth retrying
+func isGitNetworkError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, networkError := range gitNetworkErrors {
+		if strings.Contains(msg, networkError) {
+			return true
+		}
+	}
+	return false
+}
+
+// runGitPush runs the given git push, retrying with backoff up to --git-retries times if it fails with a network
+// error. Pushes rejected by the remote, e.g. because a tag already exists, fail straight away
+func (cmd *baseCommand) runGitPush(description string, params ...string) {
+	if cmd.dryRun {
+		cmd.logCommand(description, "git", params...)
+		return
+	}
+
+	delay := DefaultGitRetryDelay
+	err := cmd.tryRunCommand(description, "git", params...)
+	for attempt := 1; err != nil && attempt <= cmd.gitRetries && isGitNetworkError(err); attempt++ {
+		cmd.infof("%v failed: %v. retry %v of %v in %v\n", description, err, attempt, cmd.gitRetries, delay)
+		time.Sleep(delay)
+		delay *= 2
+		err = cmd.tryRunCommand(description, "git", params...)
+	}
+	if err != nil {
+		cmd.failf("error %v: %v\n", description, err)
+	}
+}
+
+// requireCleanTree fails if tracked files have uncommitted changes, unless --allow-dirty is set, so local edits aren't
+// shipped by accident. Untracked files are ignored, as build output such as the release dir usually is untracked
+func (cmd *baseCommand) requireCleanTree() {
+	status := cmd.runCommandWithOutput("check for uncommitted changes", "git", "status", "--porcelain", "--untracked-files=no")
+	if len(status) == 0 {
+		return
+	}
+	if cmd.allowDirty {
+		cmd.errorf("warning: working tree has uncommitted changes, continuing as --allow-dirty is set:\n%v\n", strings.Join(status, "\n"))
+		return
+	}
+	cmd.failf("working tree has uncommitted changes. commit them, or use --allow-dirty:\n%v\n", strings.Join(status, "\n"))
+}
+
+// gitRefExists returns true if the given tag, branch or sha resolves to a commit
+func (cmd *baseCommand) gitRefExists(ref string) bool {
+	cmd.logCommand("verify git ref", "git", "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	return exec.CommandContext(cmd.ctx, "git", "rev-parse", "--verify", "--quiet", ref+"^{commit}").Run() == nil
+}
+
 func (cmd *baseCommand) getCmdOutputOneLine(description string, name string, params ...string) string {
 	output := cmd.runCommandWithOutput(description, name, params...)
 	if len(output) != 1 {
@@ -167,15 +447,28 @@ func (cmd *baseCommand) getGoEnv() map[string]string {
 }
 
 func (cmd *baseCommand) runCommandWithOutput(description string, name string, params ...string) []string {
-	cmd.infof("%v: %v %v\n", description, name, strings.Join(params, " "))
-	command := exec.Command(name, params...)
+	cmd.logCommand(description, name, params...)
+	command := exec.CommandContext(cmd.ctx, name, params...)
 	command.Stderr = os.Stderr
-	output, err := command.Output()
-	if err != nil {
-		cmd.failf("error %v: %v\n", description, err)
+
+	output := &bytes.Buffer{}
+	command.Stdout = output
+	if cmd.verbose {
+		stdout := newCommandOutputWriter(os.Stderr, cmd.logPrefix+"["+description+"] ")
+		stderr := newCommandOutputWriter(os.Stderr, cmd.logPrefix+"["+description+"] ")
+		defer stdout.flush()
+		defer stderr.flush()
+		command.Stdout = io.MultiWriter(output, stdout)
+		command.Stderr = stderr
+	}
+	stderrTail := newOutputTail(CommandErrorTailLines)
+	command.Stderr = io.MultiWriter(command.Stderr, stderrTail)
+
+	if err := command.Run(); err != nil {
+		cmd.failf("error %v: %v\n", description, stderrTail.wrap(err))
 	}
 
-	stringData := strings.Replace(string(output), "\r\n", "\n", -1)
+	stringData := strings.Replace(output.String(), "\r\n", "\n", -1)
 	lines := strings.Split(stringData, "\n")
 	var result []string
 	for _, line := range lines {
@@ -187,20 +480,107 @@ func (cmd *baseCommand) runCommandWithOutput(description string, name string, pa
 }
 
 func (cmd *baseCommand) runCommand(description string, name string, params ...string) {
-	cmd.infof("%v: %v %v\n", description, name, strings.Join(params, " "))
-	command := exec.Command(name, params...)
+	if err := cmd.tryRunCommand(description, name, params...); err != nil {
+		cmd.failf("error %v: %v\n", description, err)
+	}
+}
+
+// runCommandWithRetry runs the given command, retrying up to the given number of times on failure. The delay between
+// attempts starts at baseDelay and doubles after each failed attempt. If attemptTimeout is set, attempts which take
+// longer are killed and count as failures
+func (cmd *baseCommand) runCommandWithRetry(description string, retries int, baseDelay time.Duration, attemptTimeout time.Duration, name string, params ...string) {
+	if err := cmd.tryRunCommandWithRetry(description, retries, baseDelay, attemptTimeout, name, params...); err != nil {
+		cmd.failf("error %v: %v\n", description, err)
+	}
+}
+
+func (cmd *baseCommand) tryRunCommandWithRetry(description string, retries int, baseDelay time.Duration, attemptTimeout time.Duration, name string, params ...string) error {
+	delay := baseDelay
+	err := cmd.tryRunCommandWithTimeout(description, attemptTimeout, name, params...)
+	for attempt := 1; err != nil && attempt <= retries; attempt++ {
+		cmd.infof("%v failed: %v. retry %v of %v in %v\n", description, err, attempt, retries, delay)
+		time.Sleep(delay)
+		delay *= 2
+		err = cmd.tryRunCommandWithTimeout(description, attemptTimeout, name, params...)
+	}
+	if err != nil {
+		return fmt.Errorf("failed after %v attempts: %v", retries+1, err)
+	}
+	return nil
+}
+
+func (cmd *baseCommand) tryRunCommand(description string, name string, params ...string) error {
+	return cmd.tryRunCommandWithTimeout(description, 0, name, params...)
+}
+
+// tryRunCommandWithTimeout runs the given command, killing it if it runs for longer than timeout. A timeout of 0 means
+// the command only stops when the overall command context is done
+func (cmd *baseCommand) tryRunCommandWithTimeout(description string, timeout time.Duration, name string, params ...string) error {
+	cmd.logCommand(description, name, params...)
+
+	ctx := cmd.ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	command := exec.CommandContext(ctx, name, params...)
 	command.Stderr = os.Stderr
-	command.Stdout = os.Stdout
+	command.Stdout = cmd.cmd.OutOrStdout()
+
+	// in verbose mode output is prefixed, so the output of parallel commands, such as uploads, can be told apart
+	if cmd.verbose {
+		stdout := newCommandOutputWriter(cmd.cmd.OutOrStdout(), cmd.logPrefix+"["+description+"] ")
+		stderr := newCommandOutputWriter(os.Stderr, cmd.logPrefix+"["+description+"] ")
+		defer stdout.flush()
+		defer stderr.flush()
+		command.Stdout = stdout
+		command.Stderr = stderr
+	}
+	stderrTail := newOutputTail(CommandErrorTailLines)
+	command.Stderr = io.MultiWriter(command.Stderr, stderrTail)
 
 	if name == "jfrog" {
 		command.Env = append(command.Env, "JFROG_CLI_OFFER_CONFIG=false")
+		if cmd.verbose {
+			command.Env = append(command.Env, "JFROG_CLI_LOG_LEVEL=DEBUG")
+		}
 	}
 
-	if name != "jfrog" || !cmd.dryRun {
-		if err := command.Run(); err != nil {
-			cmd.failf("error %v: %v\n", description, err)
+	if cmd.dryRun && dryRunSkippedCommands[name] {
+		cmd.infof("dry run, not executing: %v\n", description)
+		return nil
+	}
+
+	err := command.Run()
+	if err != nil && ctx.Err() == context.DeadlineExceeded && cmd.ctx.Err() == nil {
+		return stderrTail.wrap(fmt.Errorf("timed out after %v: %v", timeout, err))
+	}
+	return stderrTail.wrap(err)
+}
+
+// redactArgs returns a copy of the given command line arguments with the values of secret flags, and any secrets
+// taken from the environment, masked out
+func redactArgs(params []string) []string {
+	result := make([]string, len(params))
+	redactNext := false
+	for idx, param := range params {
+		if redactNext {
+			result[idx] = "***"
+			redactNext = false
+		} else if param == "--apikey" || param == "--access-token" {
+			result[idx] = param
+			redactNext = true
+		} else if strings.HasPrefix(param, "--apikey=") {
+			result[idx] = "--apikey=***"
+		} else if strings.HasPrefix(param, "--access-token=") {
+			result[idx] = "--access-token=***"
+		} else {
+			result[idx] = redactSecrets(param)
 		}
 	}
+	return result
 }
 
 func (cmd *baseCommand) getVersionList(params ...string) []*version.Version {
@@ -213,9 +593,13 @@ func (cmd *baseCommand) getVersionList(params ...string) []*version.Version {
 			continue
 		}
 
-		v, err := version.NewVersion(line)
-		if err != nil && cmd.verbose {
-			cmd.errorf("failure interpreting tag version on %v: %v\n", line, err)
+		// tags without the prefix are parsed as is, so bare and v prefixed semver tags from before --version-prefix
+		// was set are still found
+		v, err := version.NewVersion(strings.TrimPrefix(line, cmd.versionPrefix))
+		if err != nil {
+			if cmd.verbose {
+				cmd.errorf("failure interpreting tag version on %v: %v\n", line, err)
+			}
 			continue
 		}
 		versions = append(versions, v)
@@ -235,11 +619,11 @@ func (cmd *baseCommand) getCurrentBranch() string {
 	if cmd.currentBranch == nil {
 		branchName := ""
 
-		if val, found := os.LookupEnv("TRAVIS_PULL_REQUEST_BRANCH"); found && val != "" {
-			branchName = val
-		} else if val, found := os.LookupEnv("TRAVIS_BRANCH"); found && val != "" {
-			branchName = val
-		} else {
+		if provider := cmd.getCiProvider(); provider != nil {
+			branchName = provider.getBranch()
+		}
+
+		if branchName == "" {
 			branchName = cmd.getCmdOutputOneLine("get git branch", "git", "rev-parse", "--abbrev-ref", "HEAD")
 		}
 		cmd.currentBranch = &branchName
@@ -247,11 +631,35 @@ func (cmd *baseCommand) getCurrentBranch() string {
 	return *cmd.currentBranch
 }
 
+func (cmd *baseCommand) validateReleaseBranchPattern() {
+	var err error
+	if cmd.releaseBranchRegex, err = regexp.Compile(cmd.releaseBranchPattern); err != nil {
+		cmd.failf("invalid release branch pattern '%v'. err: %v\n", cmd.releaseBranchPattern, err)
+	}
+}
+
+func (cmd *baseCommand) isReleaseBranch() bool {
+	return cmd.releaseBranchRegex.MatchString(cmd.getCurrentBranch())
+}
+
+func (cmd *baseCommand) validateBuildNumberOverride() {
+	if cmd.buildNumberOverride == "" {
+		return
+	}
+	if val, err := strconv.Atoi(cmd.buildNumberOverride); err != nil || val < 1 {
+		cmd.failf("invalid build number: '%v'. Must be a positive integer\n", cmd.buildNumberOverride)
+	}
+}
+
 func (cmd *baseCommand) getBuildNumber() string {
 	if cmd.buildNumber == nil {
 		buildNumber := "0"
-		if val, found := os.LookupEnv("TRAVIS_BUILD_NUMBER"); found && val != "" {
-			buildNumber = val
+		if cmd.buildNumberOverride != "" {
+			buildNumber = cmd.buildNumberOverride
+		} else if provider := cmd.getCiProvider(); provider != nil {
+			if val := provider.getBuildNumber(); val != "" {
+				buildNumber = val
+			}
 		}
 		cmd.buildNumber = &buildNumber
 	}
@@ -321,7 +729,7 @@ func (cmd *baseCommand) tarGzSimple(archiveFile string, filesToInclude ...string
 		_, fileName := filepath.Split(file)
 		nameMap[file] = fileName
 	}
-	cmd.tarGz(archiveFile, nameMap)
+	cmd.tarGz(archiveFile, nameMap, false)
 }
 
 func (cmd *baseCommand) tarGzArtifacts(archiveFile string, artifacts ...*artifact) {
@@ -329,46 +737,275 @@ func (cmd *baseCommand) tarGzArtifacts(archiveFile string, artifacts ...*artifac
 	for _, artifact := range artifacts {
 		nameMap[artifact.sourcePath] = fmt.Sprintf("%v/%v/%v", artifact.arch, artifact.os, artifact.sourceName)
 	}
-	cmd.tarGz(archiveFile, nameMap)
+	cmd.tarGz(archiveFile, nameMap, true)
+}
+
+// archiveExtension returns the file extension for archives produced using the configured compression
+func (cmd *baseCommand) archiveExtension() string {
+	if cmd.compression == CompressionZstd {
+		return ".tar.zst"
+	}
+	if cmd.compression == CompressionXz {
+		return ".tar.xz"
+	}
+	return ".tar.gz"
+}
+
+func (cmd *baseCommand) archiveContentType() string {
+	if cmd.compression == CompressionZstd {
+		return "application/zstd"
+	}
+	if cmd.compression == CompressionXz {
+		return "application/x-xz"
+	}
+	return "application/gzip"
+}
+
+// artifactArchiveExtension returns the archive extension for artifacts of the given os. Windows artifacts are zipped,
+// unless tar archives are requested with --windows-archive
+func (cmd *baseCommand) artifactArchiveExtension(osName string) string {
+	if osName == "windows" && cmd.windowsArchive != ArchiveFormatTar {
+		return ".zip"
+	}
+	return cmd.archiveExtension()
+}
+
+// artifactContentType returns the content type of the given artifact archive
+func (cmd *baseCommand) artifactContentType(archiveName string) string {
+	if strings.HasSuffix(archiveName, ".zip") {
+		return "application/zip"
+	}
+	return cmd.archiveContentType()
+}
+
+// fileContentTypes maps the suffixes of published files to the content type they are served with. Longer suffixes
+// come first, so .cdx.json isn't served as plain json
+var fileContentTypes = []struct {
+	suffix      string
+	contentType string
+}{
+	{".tar.gz", "application/gzip"},
+	{".tgz", "application/gzip"},
+	{".tar.zst", "application/zstd"},
+	{".tar.xz", "application/x-xz"},
+	{".zip", "application/zip"},
+	{".deb", "application/vnd.debian.binary-package"},
+	{".rpm", "application/x-rpm"},
+	{".cdx.json", "application/vnd.cyclonedx+json"},
+	{".intoto.jsonl", "application/vnd.in-toto+json"},
+	{".json", "application/json"},
+	{".asc", "application/pgp-signature"},
+	{".pem", "application/x-pem-file"},
+	{".sig", "text/plain"},
+	{".txt", "text/plain"},
+	{CombinedChecksumsFile, "text/plain"},
+}
+
+// getFileContentType returns the content type a published file should be served with, based on its name
+func getFileContentType(fileName string) string {
+	if isChecksumFile(fileName) {
+		return "text/plain"
+	}
+	for _, fileContentType := range fileContentTypes {
+		if strings.HasSuffix(fileName, fileContentType.suffix) {
+			return fileContentType.contentType
+		}
+	}
+	return "application/octet-stream"
 }
 
-func (cmd *baseCommand) tarGz(archiveFile string, nameMap map[string]string) {
+func (cmd *baseCommand) newCompressionWriter(out io.Writer, archiveFile string) io.WriteCloser {
+	if cmd.compression == CompressionZstd {
+		zw, err := zstd.NewWriter(out)
+		if err != nil {
+			cmd.failf("unexpected err trying to create zstd writer for %v. err: %+v\n", archiveFile, err)
+		}
+		return zw
+	}
+	if cmd.compression == CompressionXz {
+		zw, err := xz.NewWriter(out)
+		if err != nil {
+			cmd.failf("unexpected err trying to create xz writer for %v. err: %+v\n", archiveFile, err)
+		}
+		return zw
+	}
+	level := cmd.getCompressionLevel()
+	if cmd.parallelCompression {
+		zw, err := pgzip.NewWriterLevel(out, level)
+		if err == nil {
+			err = zw.SetConcurrency(1<<20, runtime.GOMAXPROCS(0))
+		}
+		if err != nil {
+			cmd.failf("unexpected err trying to create parallel gzip writer for %v. err: %+v\n", archiveFile, err)
+		}
+		return zw
+	}
+	zw, err := gzip.NewWriterLevel(out, level)
+	if err != nil {
+		cmd.failf("unexpected err trying to create gzip writer for %v. err: %+v\n", archiveFile, err)
+	}
+	return zw
+}
+
+// getCompressionLevel returns the gzip compression level to use. Unless a level is given, snapshot builds favour
+// speed and release builds use the default level
+func (cmd *baseCommand) getCompressionLevel() int {
+	if cmd.compressionLevel != 0 {
+		return cmd.compressionLevel
+	}
+	if cmd.isReleaseBranch() {
+		return gzip.DefaultCompression
+	}
+	return gzip.BestSpeed
+}
+
+// zipFiles writes the given files to a zip archive, deflated at the configured compression level. nameMap maps each
+// file path to its name in the archive
+func (cmd *baseCommand) zipFiles(archiveFile string, nameMap map[string]string) {
+	if err := cmd.tryZipFiles(archiveFile, nameMap); err != nil {
+		cmd.failf("%v\n", err)
+	}
+}
+
+func (cmd *baseCommand) tryZipFiles(archiveFile string, nameMap map[string]string) error {
 	outputFile, err := os.Create(archiveFile)
 	if err != nil {
-		cmd.failf("unexpected err trying to write to %v. err: %+v\n", archiveFile, err)
+		return fmt.Errorf("unexpected err trying to write to %v. err: %+v", archiveFile, err)
+	}
+	defer cmd.close(outputFile, archiveFile)
+
+	zw := zip.NewWriter(outputFile)
+	defer cmd.close(zw, "zip writer for "+archiveFile)
+
+	level := cmd.getCompressionLevel()
+	zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, level)
+	})
+
+	var filePaths []string
+	for filePath := range nameMap {
+		filePaths = append(filePaths, filePath)
 	}
-	gzw := gzip.NewWriter(outputFile)
-	defer cmd.close(gzw, "gzip writer for "+archiveFile)
+	sort.Slice(filePaths, func(i, j int) bool {
+		return nameMap[filePaths[i]] < nameMap[filePaths[j]]
+	})
 
-	tw := tar.NewWriter(gzw)
+	for _, filePath := range filePaths {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return fmt.Errorf("unexpected err trying to open file %v. err: %+v", filePath, err)
+		}
+		fileInfo, err := file.Stat()
+		if err != nil {
+			cmd.close(file, "source file "+filePath)
+			return fmt.Errorf("unexpected err trying to read state file %v. err: %+v", filePath, err)
+		}
+
+		header, err := zip.FileInfoHeader(fileInfo)
+		if err != nil {
+			cmd.close(file, "source file "+filePath)
+			return fmt.Errorf("unexpected err trying to create zip header for %v. err: %+v", filePath, err)
+		}
+		header.Name = nameMap[filePath]
+		header.Method = zip.Deflate
+
+		writer, err := zw.CreateHeader(header)
+		if err != nil {
+			cmd.close(file, "source file "+filePath)
+			return fmt.Errorf("unexpected err trying to write zip header for %v. err: %+v", filePath, err)
+		}
+		_, err = io.Copy(writer, file)
+		cmd.close(file, "source file "+filePath)
+		if err != nil {
+			return fmt.Errorf("unexpected err trying to write file %v to zip file. err: %+v", filePath, err)
+		}
+	}
+	return nil
+}
+
+// tarGz writes the files in nameMap to the archive under their mapped names. If includeChecksums is set, a SHA256SUMS
+// file listing the checksum of every included file is appended as the last entry
+func (cmd *baseCommand) tarGz(archiveFile string, nameMap map[string]string, includeChecksums bool) {
+	if err := cmd.tryTarGz(archiveFile, nameMap, includeChecksums); err != nil {
+		cmd.failf("%v\n", err)
+	}
+}
+
+func (cmd *baseCommand) tryTarGz(archiveFile string, nameMap map[string]string, includeChecksums bool) error {
+	outputFile, err := os.Create(archiveFile)
+	if err != nil {
+		return fmt.Errorf("unexpected err trying to write to %v. err: %+v", archiveFile, err)
+	}
+	defer cmd.close(outputFile, archiveFile)
+
+	compressor := cmd.newCompressionWriter(outputFile, archiveFile)
+	defer cmd.close(compressor, "compression writer for "+archiveFile)
+
+	tw := tar.NewWriter(compressor)
 	defer cmd.close(tw, "tar writer for "+archiveFile)
 
-	for filePath, name := range nameMap {
+	var filePaths []string
+	for filePath := range nameMap {
+		filePaths = append(filePaths, filePath)
+	}
+	sort.Slice(filePaths, func(i, j int) bool {
+		return nameMap[filePaths[i]] < nameMap[filePaths[j]]
+	})
+
+	checksums := &bytes.Buffer{}
+	// SHA256SUMS gets the mod time of the newest file, rather than the current time, so rebuilding the same files
+	// produces an identical archive
+	var checksumsModTime time.Time
+
+	for _, filePath := range filePaths {
+		name := nameMap[filePath]
 		file, err := os.Open(filePath)
 		if err != nil {
-			cmd.failf("unexpected err trying to open file %v. err: %+v\n", filePath, err)
+			return fmt.Errorf("unexpected err trying to open file %v. err: %+v", filePath, err)
 		}
 		fileInfo, err := file.Stat()
 		if err != nil {
-			cmd.close(gzw, "source file "+filePath)
-			cmd.failf("unexpected err trying to read state file %v. err: %+v\n", filePath, err)
+			cmd.close(file, "source file "+filePath)
+			return fmt.Errorf("unexpected err trying to read state file %v. err: %+v", filePath, err)
 		}
 
 		header, err := tar.FileInfoHeader(fileInfo, "")
 		if err != nil {
-			cmd.close(gzw, "source file "+filePath)
-			cmd.failf("unexpected err trying to create tar header for %v. err: %+v\n", filePath, err)
+			cmd.close(file, "source file "+filePath)
+			return fmt.Errorf("unexpected err trying to create tar header for %v. err: %+v", filePath, err)
 		}
 		header.Name = name
+		if header.ModTime.After(checksumsModTime) {
+			checksumsModTime = header.ModTime
+		}
 		if err = tw.WriteHeader(header); err != nil {
-			cmd.close(gzw, "source file "+filePath)
-			cmd.failf("unexpected err trying to write tar header for %v. err: %+v\n", filePath, err)
+			cmd.close(file, "source file "+filePath)
+			return fmt.Errorf("unexpected err trying to write tar header for %v. err: %+v", filePath, err)
 		}
 
-		_, err = io.Copy(tw, file)
+		hash := sha256.New()
+		_, err = io.Copy(io.MultiWriter(tw, hash), file)
 		cmd.close(file, "source file "+filePath)
 		if err != nil {
-			cmd.failf("unexpected err trying to write file %v to tar file. err: %+v\n", filePath, err)
+			return fmt.Errorf("unexpected err trying to write file %v to tar file. err: %+v", filePath, err)
+		}
+		_, _ = fmt.Fprintf(checksums, "%v  %v\n", hex.EncodeToString(hash.Sum(nil)), name)
+	}
+
+	if includeChecksums {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     "SHA256SUMS",
+			Mode:     0644,
+			Size:     int64(checksums.Len()),
+			ModTime:  checksumsModTime,
+		}
+		if err = tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("unexpected err trying to write tar header for SHA256SUMS. err: %+v", err)
+		}
+		if _, err = io.Copy(tw, checksums); err != nil {
+			return fmt.Errorf("unexpected err trying to write SHA256SUMS to tar file. err: %+v", err)
 		}
 	}
+	return nil
 }
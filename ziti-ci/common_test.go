@@ -0,0 +1,125 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readTarHeaders returns the headers of each entry in a gzipped tar file, keyed by name
+func readTarHeaders(t *testing.T, archiveFile string) map[string]*tar.Header {
+	file, err := os.Open(archiveFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := map[string]*tar.Header{}
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return headers
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers[header.Name] = header
+	}
+}
+
+func TestTarGzKeepsFileMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ziti-ci-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	executable := filepath.Join(dir, "ziti")
+	if err = ioutil.WriteFile(executable, []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	readme := filepath.Join(dir, "README")
+	if err = ioutil.WriteFile(readme, []byte("docs"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// make sure the umask didn't change the modes we're checking for
+	for path, mode := range map[string]os.FileMode{executable: 0755, readme: 0644} {
+		if err = os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd, _ := newTestCommand(LogFormatText)
+	cmd.compression = CompressionGzip
+	cmd.compressionLevel = gzip.BestSpeed
+
+	archiveFile := filepath.Join(dir, "ziti.tar.gz")
+	nameMap := map[string]string{executable: "ziti", readme: "README"}
+	if err = cmd.tryTarGz(archiveFile, nameMap, true); err != nil {
+		t.Fatal(err)
+	}
+
+	headers := readTarHeaders(t, archiveFile)
+	for name, mode := range map[string]int64{"ziti": 0755, "README": 0644, "SHA256SUMS": 0644} {
+		header, found := headers[name]
+		if !found {
+			t.Fatalf("%v missing from archive", name)
+		}
+		if header.Mode&0777 != mode {
+			t.Errorf("expected %v to have mode %o, got %o", name, mode, header.Mode&0777)
+		}
+	}
+}
+
+func TestTarGzIsReproducible(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ziti-ci-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	binary := filepath.Join(dir, "ziti")
+	if err = ioutil.WriteFile(binary, []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err = os.Chtimes(binary, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, _ := newTestCommand(LogFormatText)
+	cmd.compression = CompressionGzip
+	cmd.compressionLevel = gzip.BestSpeed
+
+	var archives [][]byte
+	for _, name := range []string{"first.tar.gz", "second.tar.gz"} {
+		archiveFile := filepath.Join(dir, name)
+		if err = cmd.tryTarGz(archiveFile, map[string]string{binary: "ziti"}, true); err != nil {
+			t.Fatal(err)
+		}
+		if header := readTarHeaders(t, archiveFile)["SHA256SUMS"]; header == nil || !header.ModTime.Equal(modTime) {
+			t.Fatalf("expected SHA256SUMS to have the mod time of the newest file, %v, got %+v", modTime, header)
+		}
+		data, err := ioutil.ReadFile(archiveFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archives = append(archives, data)
+	}
+
+	if !bytes.Equal(archives[0], archives[1]) {
+		t.Errorf("archiving the same files twice produced different archives")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"os"
+	"strings"
+)
+
+const (
+	DefaultConfigFile = "./.ziti-ci.yml"
+)
+
+// loadConfig applies values from the config file to any flags which weren't explicitly set on the command line. Keys
+// are flag names. Keys for flags which the current command doesn't have are ignored, so one file can serve all commands
+func (cmd *baseCommand) loadConfig() {
+	if _, err := os.Stat(cmd.configFile); os.IsNotExist(err) {
+		if cmd.cmd.Flags().Changed("config") {
+			cmd.failf("config file %v not found\n", cmd.configFile)
+		}
+		return
+	}
+
+	config := viper.New()
+	config.SetConfigFile(cmd.configFile)
+	config.SetConfigType("yaml")
+	if err := config.ReadInConfig(); err != nil {
+		cmd.failf("unexpected err trying to read config file %v. err: %+v\n", cmd.configFile, err)
+	}
+
+	flags := cmd.cmd.Flags()
+	for _, key := range config.AllKeys() {
+		flag := flags.Lookup(key)
+		if flag == nil {
+			if cmd.verbose {
+				cmd.infof("config key %v doesn't apply to command %v, skipping\n", key, cmd.cmd.Name())
+			}
+			continue
+		}
+		if flag.Changed {
+			continue
+		}
+		for _, value := range configValueStrings(flag, config.Get(key)) {
+			if err := flags.Set(key, value); err != nil {
+				cmd.failf("invalid value for %v in config file %v. err: %+v\n", key, cmd.configFile, err)
+			}
+		}
+	}
+}
+
+// configValueStrings renders a config value in the form the flag would take on the command line. Lists are set one
+// item at a time, as if the flag were repeated, so items containing commas aren't split apart
+func configValueStrings(flag *pflag.Flag, value interface{}) []string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return []string{fmt.Sprintf("%v", value)}
+	}
+
+	var result []string
+	for _, item := range list {
+		itemString := fmt.Sprintf("%v", item)
+		// string slices parse each value as csv, so quote the item to keep it whole
+		if flag.Value.Type() == "stringSlice" && strings.ContainsAny(itemString, ",\"") {
+			itemString = `"` + strings.Replace(itemString, `"`, `""`, -1) + `"`
+		}
+		result = append(result, itemString)
+	}
+	return result
+}
@@ -13,6 +13,10 @@ const (
 	DefaultGitEmail     = "ziti-ci@netfoundry.io"
 	DefaultSshKeyEnvVar = "gh_ci_key"
 	DefaultSshKeyFile   = "github_deploy_key"
+
+	// githubTokenCredentialHelper reads the token from the environment when git asks for credentials, so the token
+	// itself is never written to the git config
+	githubTokenCredentialHelper = `!f() { echo "username=x-access-token"; echo "password=${GITHUB_TOKEN}"; }; f`
 )
 
 type configureGitCmd struct {
@@ -23,9 +27,22 @@ type configureGitCmd struct {
 
 	sshKeyEnv  string
 	sshKeyFile string
+
+	useGithubToken bool
 }
 
 func (cmd *configureGitCmd) execute() {
+	cmd.runGitCommand("set git username", "config", "user.name", cmd.gitUsername)
+	cmd.runGitCommand("set git email", "config", "user.email", cmd.gitEmail)
+
+	if cmd.useGithubToken {
+		cmd.configureHttps()
+	} else {
+		cmd.configureSsh()
+	}
+}
+
+func (cmd *configureGitCmd) configureSsh() {
 	if val, found := os.LookupEnv(cmd.sshKeyEnv); found && val != "" {
 		sshKey, err := base64.StdEncoding.DecodeString(val)
 		if err != nil {
@@ -38,8 +55,6 @@ func (cmd *configureGitCmd) execute() {
 		cmd.failf("unable to read ssh key from env var %v. Found? %v\n", cmd.sshKeyEnv, found)
 	}
 
-	cmd.runGitCommand("set git username", "config", "user.name", cmd.gitUsername)
-	cmd.runGitCommand("set git password", "config", "user.email", cmd.gitEmail)
 	cmd.runGitCommand("set ssh config", "config", "core.sshCommand", fmt.Sprintf("ssh -i %v", cmd.sshKeyFile))
 
 	// Ensure we're in ssh mode
@@ -49,6 +64,20 @@ func (cmd *configureGitCmd) execute() {
 	}
 }
 
+func (cmd *configureGitCmd) configureHttps() {
+	if val, found := os.LookupEnv("GITHUB_TOKEN"); !found || val == "" {
+		cmd.failf("unable to read github token from env var GITHUB_TOKEN. Found? %v\n", found)
+	}
+
+	cmd.runGitCommand("set https credential helper", "config", "credential.https://github.com.helper", githubTokenCredentialHelper)
+
+	// Ensure we're in https mode
+	if repoSlug, ok := os.LookupEnv("TRAVIS_REPO_SLUG"); ok {
+		url := fmt.Sprintf("https://github.com/%v.git", repoSlug)
+		cmd.runGitCommand("set remote to https", "remote", "set-url", "origin", url)
+	}
+}
+
 func newConfigureGitCmd(root *rootCommand) *cobra.Command {
 	cobraCmd := &cobra.Command{
 		Use:   "configure-git",
@@ -67,6 +96,7 @@ func newConfigureGitCmd(root *rootCommand) *cobra.Command {
 	cobraCmd.PersistentFlags().StringVar(&result.gitEmail, "git-email", DefaultGitEmail, "override the default git email")
 	cobraCmd.PersistentFlags().StringVar(&result.sshKeyEnv, "ssh-key-env-var", DefaultSshKeyEnvVar, "set ssh key environment variable name")
 	cobraCmd.PersistentFlags().StringVar(&result.sshKeyFile, "ssh-key-file", DefaultSshKeyFile, "set ssh key file name")
+	cobraCmd.PersistentFlags().BoolVar(&result.useGithubToken, "use-github-token", false, "authenticate to github over https using the GITHUB_TOKEN env var, instead of an ssh key")
 
 	return finalize(result)
 }
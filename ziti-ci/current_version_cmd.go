@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+type currentVersionCmd struct {
+	baseCommand
+	prefix      bool
+	noPrefix    bool
+	placeholder string
+}
+
+func (cmd *currentVersionCmd) execute() {
+	// keep stdout clean for the version itself
+	cmd.cmd.SetOut(os.Stderr)
+
+	if cmd.prefix && cmd.noPrefix {
+		cmd.failf("--prefix and --no-prefix can't be used together\n")
+	}
+
+	cmd.evalCurrentAndNextVersion()
+
+	// there is no current version when the base version starts a new major or minor version, which hasn't been
+	// released yet
+	if cmd.currentVersion == nil {
+		fmt.Println(cmd.placeholder)
+		return
+	}
+
+	currentVersion := cmd.currentVersion.String()
+	if cmd.prefix {
+		currentVersion = cmd.getTagName(currentVersion)
+	}
+	fmt.Println(currentVersion)
+}
+
+func newCurrentVersionCmd(root *rootCommand) *cobra.Command {
+	cobraCmd := &cobra.Command{
+		Use:   "current-version",
+		Short: "Print the current released version, with no other output, e.g. VERSION=$(ziti-ci current-version)",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	result := &currentVersionCmd{
+		baseCommand: baseCommand{
+			rootCommand: root,
+			cmd:         cobraCmd,
+		},
+	}
+
+	cobraCmd.PersistentFlags().BoolVar(&result.prefix, "prefix", false, "include the --version-prefix, as used for tags")
+	cobraCmd.PersistentFlags().BoolVar(&result.noPrefix, "no-prefix", false, "print the bare version. This is the default")
+	cobraCmd.PersistentFlags().StringVar(&result.placeholder, "placeholder", "", "print this instead when nothing has been released for the base version yet")
+
+	return finalize(result)
+}
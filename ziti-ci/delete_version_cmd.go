@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/cobra"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type deleteVersionCmd struct {
+	artifactoryCommand
+	version   string
+	buildName string
+	confirm   bool
+}
+
+func (cmd *deleteVersionCmd) execute() {
+	if cmd.version == "" {
+		cmd.failf("--version must be provided\n")
+	}
+
+	cmd.initJfrog()
+
+	// every upload is tagged with its version, which covers the per artifact and ziti-all paths, as well as rpms
+	var paths []string
+	for _, repo := range []string{cmd.stagingRepo, cmd.rpmRepo} {
+		for _, result := range cmd.search(repo+"/*", "version="+cmd.version) {
+			paths = append(paths, result.Path)
+		}
+	}
+
+	if len(paths) == 0 {
+		cmd.infof("no artifacts found for version %v\n", cmd.version)
+	} else {
+		cmd.summaryf("found %v artifacts for version %v:\n", len(paths), cmd.version)
+		for _, artifactPath := range paths {
+			cmd.summaryf("  %v\n", artifactPath)
+		}
+
+		if !cmd.confirm && !cmd.confirmInteractively() {
+			cmd.failf("not deleting version %v. Use --confirm to delete without being prompted\n", cmd.version)
+		}
+
+		for _, artifactPath := range paths {
+			cmd.runCommand("Delete "+artifactPath, "jfrog", "rt", "del", artifactPath,
+				"--quiet",
+				cmd.jfrogAuthFlag, cmd.jfrogAuthSecret,
+				"--url", cmd.artifactoryUrl)
+		}
+	}
+
+	if cmd.deleteBuildInfo() {
+		cmd.summaryf("deleted %v artifacts and the %v build info for version %v\n", len(paths), cmd.buildName, cmd.version)
+	} else {
+		cmd.summaryf("deleted %v artifacts for version %v. There was no %v build info to delete\n", len(paths), cmd.version, cmd.buildName)
+	}
+}
+
+// deleteBuildInfo deletes the version's build info using the artifactory REST api, returning false if there was none.
+// jfrog rt curl only works against a server configured with jfrog config, not the url and auth flags used everywhere
+// else, so isn't used here
+func (cmd *deleteVersionCmd) deleteBuildInfo() bool {
+	buildUrl := fmt.Sprintf("%v/api/build/%v", strings.TrimSuffix(cmd.artifactoryUrl, "/"), url.PathEscape(cmd.buildName))
+	description := "Delete build info"
+	cmd.infof("%v: DELETE %v?buildNumbers=%v&artifacts=0\n", description, buildUrl, cmd.version)
+	if cmd.dryRun {
+		cmd.infof("dry run, not executing: %v\n", description)
+		return true
+	}
+
+	request := resty.New().R().
+		SetContext(cmd.ctx).
+		SetQueryParam("buildNumbers", cmd.version).
+		SetQueryParam("artifacts", "0")
+	if cmd.jfrogAuthFlag == "--access-token" {
+		request.SetAuthToken(cmd.jfrogAuthSecret)
+	} else {
+		request.SetHeader("X-JFrog-Art-Api", cmd.jfrogAuthSecret)
+	}
+
+	resp, err := request.Delete(buildUrl)
+	if err != nil {
+		cmd.failf("error deleting build info for %v %v: %v\n", cmd.buildName, cmd.version, err)
+	}
+	if resp.StatusCode() == http.StatusNotFound {
+		cmd.errorf("warning: no build info found for %v %v\n", cmd.buildName, cmd.version)
+		return false
+	}
+	if resp.StatusCode() != http.StatusOK && resp.StatusCode() != http.StatusNoContent {
+		cmd.logJson(resp.Body())
+		cmd.failf("error deleting build info for %v %v. REST call returned %v\n", cmd.buildName, cmd.version, resp.StatusCode())
+	}
+	return true
+}
+
+// confirmInteractively asks the user to type the version to confirm the delete. Without a terminal to ask on, the
+// delete is not confirmed
+func (cmd *deleteVersionCmd) confirmInteractively() bool {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	fmt.Printf("type the version to confirm deleting it: ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(answer) == cmd.version
+}
+
+func newDeleteVersionCmd(root *rootCommand) *cobra.Command {
+	cobraCmd := &cobra.Command{
+		Use:   "delete-version",
+		Short: "Deletes all released artifacts and the build info for a version from artifactory",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	result := &deleteVersionCmd{
+		artifactoryCommand: artifactoryCommand{
+			baseCommand: baseCommand{
+				rootCommand: root,
+				cmd:         cobraCmd,
+			},
+		},
+	}
+
+	result.addArtifactoryFlags()
+
+	cobraCmd.PersistentFlags().StringVar(&result.version, "version", "", "released version to delete")
+	cobraCmd.PersistentFlags().StringVar(&result.buildName, "build-name", "ziti", "artifactory build name the version's build info was published under")
+	cobraCmd.PersistentFlags().BoolVar(&result.confirm, "confirm", false, "delete without asking for confirmation")
+
+	return finalize(result)
+}
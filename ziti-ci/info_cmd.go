@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+)
+
+type buildInfo struct {
+	CurrentVersion  string `json:"currentVersion"`
+	NextVersion     string `json:"nextVersion"`
+	PublishVersion  string `json:"publishVersion"`
+	ArtifactVersion string `json:"artifactVersion"`
+	BuildNumber     string `json:"buildNumber"`
+	Branch          string `json:"branch"`
+	ReleaseBranch   bool   `json:"releaseBranch"`
+	CiProvider      string `json:"ciProvider"`
+}
+
+type infoCmd struct {
+	baseCommand
+	json bool
+}
+
+func (cmd *infoCmd) execute() {
+	// keep stdout clean for the info itself
+	cmd.cmd.SetOut(os.Stderr)
+
+	cmd.evalCurrentAndNextVersion()
+
+	info := &buildInfo{
+		NextVersion:     cmd.nextVersion.String(),
+		PublishVersion:  cmd.getPublishVersion().String(),
+		ArtifactVersion: cmd.getArtifactVersion(),
+		BuildNumber:     cmd.getBuildNumber(),
+		Branch:          cmd.getCurrentBranch(),
+		ReleaseBranch:   cmd.isReleaseBranch(),
+		CiProvider:      "none",
+	}
+	if cmd.currentVersion != nil {
+		info.CurrentVersion = cmd.currentVersion.String()
+	}
+	if provider := cmd.getCiProvider(); provider != nil {
+		info.CiProvider = provider.name
+	}
+
+	if cmd.json {
+		data, err := json.MarshalIndent(info, "", "    ")
+		if err != nil {
+			cmd.failf("unable to marshal info to json. err: %v\n", err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintf(writer, "current version\t%v\n", info.CurrentVersion)
+	_, _ = fmt.Fprintf(writer, "next version\t%v\n", info.NextVersion)
+	_, _ = fmt.Fprintf(writer, "publish version\t%v\n", info.PublishVersion)
+	_, _ = fmt.Fprintf(writer, "artifact version\t%v\n", info.ArtifactVersion)
+	_, _ = fmt.Fprintf(writer, "build number\t%v\n", info.BuildNumber)
+	_, _ = fmt.Fprintf(writer, "branch\t%v\n", info.Branch)
+	_, _ = fmt.Fprintf(writer, "release branch\t%v\n", info.ReleaseBranch)
+	_, _ = fmt.Fprintf(writer, "ci provider\t%v\n", info.CiProvider)
+	if err := writer.Flush(); err != nil {
+		cmd.failf("unable to write info. err: %v\n", err)
+	}
+}
+
+func newInfoCmd(root *rootCommand) *cobra.Command {
+	cobraCmd := &cobra.Command{
+		Use:   "info",
+		Short: "Show the versions, branch and build number ziti-ci resolves for the current build",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	result := &infoCmd{
+		baseCommand: baseCommand{
+			rootCommand: root,
+			cmd:         cobraCmd,
+		},
+	}
+
+	cobraCmd.PersistentFlags().BoolVar(&result.json, "json", false, "output as json")
+
+	return finalize(result)
+}
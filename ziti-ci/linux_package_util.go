@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+const (
+	PackagerDeb = "deb"
+	PackagerRpm = "rpm"
+)
+
+// debArchs maps go arch names to debian arch names, where the two differ
+var debArchs = map[string]string{
+	"386": "i386",
+	"arm": "armhf",
+}
+
+// rpmArchs maps go arch names to rpm arch names, where the two differ
+var rpmArchs = map[string]string{
+	"amd64": "x86_64",
+	"arm64": "aarch64",
+	"386":   "i386",
+	"arm":   "armhfp",
+}
+
+// linuxPackageInfo holds the package metadata which isn't derived from the artifact itself
+type linuxPackageInfo struct {
+	maintainer  string
+	description string
+	homepage    string
+}
+
+// nfpmConfig is the subset of the nfpm config we need. nfpm reads yaml, which json is a subset of
+type nfpmConfig struct {
+	Name        string         `json:"name"`
+	Arch        string         `json:"arch"`
+	Platform    string         `json:"platform"`
+	Version     string         `json:"version"`
+	Maintainer  string         `json:"maintainer"`
+	Description string         `json:"description"`
+	Homepage    string         `json:"homepage,omitempty"`
+	Contents    []*nfpmContent `json:"contents"`
+}
+
+type nfpmContent struct {
+	Src      string        `json:"src"`
+	Dst      string        `json:"dst"`
+	FileInfo *nfpmFileInfo `json:"file_info"`
+}
+
+// nfpmFileInfo mode is decoded by nfpm as a number, so it must not be written as a string
+type nfpmFileInfo struct {
+	Mode uint32 `json:"mode"`
+}
+
+func (cmd *baseCommand) requireNfpm() {
+	if _, err := exec.LookPath("nfpm"); err != nil {
+		cmd.failf("linux package generation requested, but nfpm was not found on the PATH\n")
+	}
+}
+
+// getPackageArch returns the name the given packager uses for a go arch
+func getPackageArch(packager string, goArch string) string {
+	archs := debArchs
+	if packager == PackagerRpm {
+		archs = rpmArchs
+	}
+	if arch, found := archs[goArch]; found {
+		return arch
+	}
+	return goArch
+}
+
+// getPackageFileName returns the conventional package file name for the given packager
+func getPackageFileName(packager string, name string, version string, arch string) string {
+	if packager == PackagerRpm {
+		return fmt.Sprintf("%v-%v.%v.rpm", name, version, arch)
+	}
+	return fmt.Sprintf("%v_%v_%v.deb", name, version, arch)
+}
+
+// buildLinuxPackage uses nfpm to package the artifact's binary, installed to /usr/bin, and returns the package path
+func (cmd *baseCommand) buildLinuxPackage(artifact *artifact, packager string, version string, info *linuxPackageInfo) string {
+	arch := getPackageArch(packager, artifact.arch)
+	packagePath := filepath.Join(filepath.Dir(artifact.artifactPath), getPackageFileName(packager, artifact.name, version, arch))
+
+	config := &nfpmConfig{
+		Name:        artifact.name,
+		Arch:        arch,
+		Platform:    "linux",
+		Version:     version,
+		Maintainer:  info.maintainer,
+		Description: info.description,
+		Homepage:    info.homepage,
+		Contents: []*nfpmContent{{
+			Src:      artifact.sourcePath,
+			Dst:      "/usr/bin/" + artifact.name,
+			FileInfo: &nfpmFileInfo{Mode: 0755},
+		}},
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		cmd.failf("unable to marshal nfpm config for %v. err: %v\n", artifact.sourcePath, err)
+	}
+
+	configFile, err := ioutil.TempFile("", "ziti-ci-nfpm-*.yaml")
+	if err != nil {
+		cmd.failf("unable to create nfpm config file. err: %v\n", err)
+	}
+	defer func() { _ = os.Remove(configFile.Name()) }()
+
+	_, err = configFile.Write(data)
+	cmd.close(configFile, "nfpm config file "+configFile.Name())
+	if err != nil {
+		cmd.failf("unable to write nfpm config file %v. err: %v\n", configFile.Name(), err)
+	}
+
+	cmd.runCommand(fmt.Sprintf("build %v package for %v", packager, artifact.sourcePath), "nfpm", "package",
+		"--config", configFile.Name(), "--packager", packager, "--target", packagePath)
+	return packagePath
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJson = "json"
+
+	// CommandErrorTailLines is the number of lines of stderr output included when an external command fails
+	CommandErrorTailLines = 20
+)
+
+// logLock makes each log write atomic, so lines logged from parallel workers don't interleave
+var logLock sync.Mutex
+
+// logCapture, if set, gets a copy of everything logged, including info messages hidden by --quiet. It is only
+// written to under logLock
+var logCapture io.Writer
+
+// setLogCapture starts copying everything logged to the given writer, or stops if it is nil
+func setLogCapture(capture io.Writer) {
+	logLock.Lock()
+	defer logLock.Unlock()
+	logCapture = capture
+}
+
+type logEntry struct {
+	Level   string `json:"level"`
+	Msg     string `json:"msg"`
+	Ts      string `json:"ts"`
+	Command string `json:"command,omitempty"`
+}
+
+func (cmd *baseCommand) validateLogFormat() {
+	if logFormat := cmd.logFormat; logFormat != LogFormatText && logFormat != LogFormatJson {
+		// report the problem in the default format
+		cmd.logFormat = LogFormatText
+		cmd.failf("unsupported log format: '%v'. Valid values: [%v, %v]\n", logFormat, LogFormatText, LogFormatJson)
+	}
+}
+
+// logf writes a log message in the configured log format. In json format each message is written as a single line
+func (cmd *baseCommand) logf(out io.Writer, level string, format string, params ...interface{}) {
+	msg := redactSecrets(fmt.Sprintf(format, params...))
+	if cmd.logPrefix != "" {
+		msg = prefixLines(cmd.logPrefix, msg)
+	}
+	if cmd.logFormat != LogFormatJson {
+		logLock.Lock()
+		defer logLock.Unlock()
+		_, _ = fmt.Fprint(out, msg)
+		if logCapture != nil {
+			_, _ = fmt.Fprint(logCapture, msg)
+		}
+		return
+	}
+	cmd.writeLogEntry(out, &logEntry{Level: level, Msg: strings.TrimRight(msg, "\n")})
+}
+
+// logCommand logs an external command which is about to be run, with secrets masked out
+func (cmd *baseCommand) logCommand(description string, name string, params ...string) {
+	command := strings.TrimSpace(name + " " + strings.Join(redactArgs(params), " "))
+	if cmd.logFormat != LogFormatJson {
+		cmd.infof("%v: %v\n", description, command)
+		return
+	}
+	cmd.writeLogEntry(cmd.cmd.OutOrStdout(), &logEntry{Level: "info", Msg: cmd.logPrefix + description, Command: command})
+}
+
+func (cmd *baseCommand) writeLogEntry(out io.Writer, entry *logEntry) {
+	entry.Ts = time.Now().UTC().Format(time.RFC3339Nano)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "unable to marshal log entry. err: %v\n", err)
+		return
+	}
+	logLock.Lock()
+	defer logLock.Unlock()
+	_, _ = fmt.Fprintln(out, string(data))
+	if logCapture != nil {
+		_, _ = fmt.Fprintln(logCapture, string(data))
+	}
+}
+
+// prefixLines prepends the prefix to each line of msg
+func prefixLines(prefix string, msg string) string {
+	trailingNewline := strings.HasSuffix(msg, "\n")
+	lines := strings.Split(strings.TrimSuffix(msg, "\n"), "\n")
+	for idx, line := range lines {
+		lines[idx] = prefix + line
+	}
+	result := strings.Join(lines, "\n")
+	if trailingNewline {
+		result += "\n"
+	}
+	return result
+}
+
+// redactedSecrets are secrets read from somewhere other than the environment, such as a key file
+var redactedSecrets []string
+
+// addRedactedSecret registers a secret to be masked out of logged output. Secrets must be registered before any
+// commands are run in parallel
+func addRedactedSecret(secret string) {
+	if secret != "" {
+		redactedSecrets = append(redactedSecrets, secret)
+	}
+}
+
+// redactSecrets masks out any secrets taken from the environment, or registered with addRedactedSecret, which appear
+// in the given string
+func redactSecrets(s string) string {
+	for _, envVar := range []string{"JFROG_API_KEY", "JFROG_ACCESS_TOKEN"} {
+		if secret := os.Getenv(envVar); secret != "" {
+			s = strings.Replace(s, secret, "***", -1)
+		}
+	}
+	for _, secret := range redactedSecrets {
+		s = strings.Replace(s, secret, "***", -1)
+	}
+	return s
+}
+
+// commandOutputWriter streams the output of an external command line by line as it arrives, prefixing each line so the
+// output of parallel commands can be told apart. Secrets are masked out
+type commandOutputWriter struct {
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func newCommandOutputWriter(out io.Writer, prefix string) *commandOutputWriter {
+	return &commandOutputWriter{out: out, prefix: prefix}
+}
+
+func (w *commandOutputWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		w.writeLine(string(w.buf[:idx+1]))
+		w.buf = w.buf[idx+1:]
+	}
+	return len(p), nil
+}
+
+// flush writes out any trailing output which didn't end with a newline
+func (w *commandOutputWriter) flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(string(w.buf) + "\n")
+		w.buf = nil
+	}
+}
+
+func (w *commandOutputWriter) writeLine(line string) {
+	logLock.Lock()
+	defer logLock.Unlock()
+	_, _ = fmt.Fprint(w.out, w.prefix+redactSecrets(line))
+}
+
+// outputTail keeps the last lines written to it, so they can be reported if an external command fails
+type outputTail struct {
+	sync.Mutex
+	maxLines int
+	lines    []string
+	partial  []byte
+}
+
+func newOutputTail(maxLines int) *outputTail {
+	return &outputTail{maxLines: maxLines}
+}
+
+func (t *outputTail) Write(p []byte) (int, error) {
+	t.Lock()
+	defer t.Unlock()
+	t.partial = append(t.partial, p...)
+	for {
+		idx := bytes.IndexByte(t.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		t.addLine(string(t.partial[:idx]))
+		t.partial = t.partial[idx+1:]
+	}
+	return len(p), nil
+}
+
+func (t *outputTail) addLine(line string) {
+	if line = strings.TrimRight(line, "\r"); line == "" {
+		return
+	}
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.maxLines {
+		t.lines = t.lines[len(t.lines)-t.maxLines:]
+	}
+}
+
+// wrap adds the captured output to the given error. Nil errors, and errors from commands which didn't write
+// anything, are returned as is
+func (t *outputTail) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	t.Lock()
+	defer t.Unlock()
+	if len(t.partial) > 0 {
+		t.addLine(string(t.partial))
+		t.partial = nil
+	}
+	if len(t.lines) == 0 {
+		return err
+	}
+	return fmt.Errorf("%v. stderr:\n    %v", err, redactSecrets(strings.Join(t.lines, "\n    ")))
+}
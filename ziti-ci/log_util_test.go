@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestCommand(logFormat string) (*baseCommand, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	cobraCmd := &cobra.Command{}
+	cobraCmd.SetOut(out)
+	cobraCmd.SetErr(out)
+	return &baseCommand{
+		rootCommand: &rootCommand{logFormat: logFormat},
+		cmd:         cobraCmd,
+	}, out
+}
+
+func TestLogCommandRedactsSecrets(t *testing.T) {
+	const envSecret = "env-secret-value"
+	const argSecret = "arg-secret-value"
+
+	if err := os.Setenv("JFROG_API_KEY", envSecret); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Unsetenv("JFROG_API_KEY") }()
+
+	tests := []struct {
+		name   string
+		params []string
+	}{
+		{name: "apikey as separate arg", params: []string{"rt", "u", "--apikey", argSecret}},
+		{name: "apikey with equals", params: []string{"rt", "u", "--apikey=" + argSecret}},
+		{name: "access token as separate arg", params: []string{"rt", "u", "--access-token", argSecret}},
+		{name: "access token with equals", params: []string{"rt", "u", "--access-token=" + argSecret}},
+		{name: "env secret in arg", params: []string{"rt", "u", "--url=https://user:" + envSecret + "@example.com"}},
+	}
+
+	for _, logFormat := range []string{LogFormatText, LogFormatJson} {
+		for _, test := range tests {
+			t.Run(logFormat+"/"+test.name, func(t *testing.T) {
+				cmd, out := newTestCommand(logFormat)
+				cmd.logCommand("upload", "jfrog", test.params...)
+
+				logged := out.String()
+				if !strings.Contains(logged, "jfrog rt u") {
+					t.Fatalf("expected the command to be logged, got: %v", logged)
+				}
+				for _, secret := range []string{envSecret, argSecret} {
+					if strings.Contains(logged, secret) {
+						t.Errorf("secret %v was not redacted from: %v", secret, logged)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestLogfRedactsSecrets(t *testing.T) {
+	const envSecret = "env-secret-value"
+
+	if err := os.Setenv("JFROG_ACCESS_TOKEN", envSecret); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Unsetenv("JFROG_ACCESS_TOKEN") }()
+
+	for _, logFormat := range []string{LogFormatText, LogFormatJson} {
+		t.Run(logFormat, func(t *testing.T) {
+			cmd, out := newTestCommand(logFormat)
+			cmd.infof("token is %v\n", envSecret)
+			cmd.errorf("token is %v\n", envSecret)
+
+			logged := out.String()
+			if strings.Contains(logged, envSecret) {
+				t.Errorf("secret was not redacted from: %v", logged)
+			}
+			if strings.Count(logged, "token is ***") != 2 {
+				t.Errorf("expected both messages with the secret masked, got: %v", logged)
+			}
+		})
+	}
+}
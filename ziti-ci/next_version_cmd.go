@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+type nextVersionCmd struct {
+	baseCommand
+	prefix   bool
+	noPrefix bool
+}
+
+func (cmd *nextVersionCmd) execute() {
+	// keep stdout clean for the version itself
+	cmd.cmd.SetOut(os.Stderr)
+
+	if cmd.prefix && cmd.noPrefix {
+		cmd.failf("--prefix and --no-prefix can't be used together\n")
+	}
+
+	cmd.evalCurrentAndNextVersion()
+
+	nextVersion := cmd.nextVersion.String()
+	if cmd.prefix {
+		nextVersion = cmd.getTagName(nextVersion)
+	}
+	fmt.Println(nextVersion)
+}
+
+func newNextVersionCmd(root *rootCommand) *cobra.Command {
+	cobraCmd := &cobra.Command{
+		Use:   "next-version",
+		Short: "Print the next version, with no other output, e.g. VERSION=$(ziti-ci next-version)",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	result := &nextVersionCmd{
+		baseCommand: baseCommand{
+			rootCommand: root,
+			cmd:         cobraCmd,
+		},
+	}
+
+	cobraCmd.PersistentFlags().BoolVar(&result.prefix, "prefix", false, "include the --version-prefix, as used for tags")
+	cobraCmd.PersistentFlags().BoolVar(&result.noPrefix, "no-prefix", false, "print the bare version. This is the default")
+
+	return finalize(result)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+type promoteCmd struct {
+	artifactoryCommand
+	branch  string
+	version string
+}
+
+func (cmd *promoteCmd) execute() {
+	if cmd.branch == "" || cmd.version == "" {
+		cmd.failf("both --branch and --version must be provided\n")
+	}
+
+	cmd.initJfrog()
+
+	snapshotRoot := fmt.Sprintf("%v/%v/", cmd.snapshotRepo, cmd.branch)
+	results := cmd.search(snapshotRoot+"*", "version="+cmd.version)
+	if len(results) == 0 {
+		cmd.failf("no artifacts found in %v for version %v\n", snapshotRoot, cmd.version)
+	}
+
+	for _, result := range results {
+		if !strings.HasPrefix(result.Path, snapshotRoot) {
+			cmd.failf("unexpected search result %v, not under %v\n", result.Path, snapshotRoot)
+		}
+		dest := cmd.stagingRepo + "/" + strings.TrimPrefix(result.Path, snapshotRoot)
+		cmd.runCommand("Promote "+result.Path, "jfrog", "rt", "cp", result.Path, dest,
+			"--flat",
+			cmd.jfrogAuthFlag, cmd.jfrogAuthSecret,
+			"--url", cmd.artifactoryUrl)
+	}
+
+	cmd.infof("promoted %v artifacts for version %v from %v to %v\n", len(results), cmd.version, snapshotRoot, cmd.stagingRepo)
+}
+
+func newPromoteCmd(root *rootCommand) *cobra.Command {
+	cobraCmd := &cobra.Command{
+		Use:   "promote",
+		Short: "Copies snapshot artifacts to the staging repository",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	result := &promoteCmd{
+		artifactoryCommand: artifactoryCommand{
+			baseCommand: baseCommand{
+				rootCommand: root,
+				cmd:         cobraCmd,
+			},
+		},
+	}
+
+	result.addArtifactoryFlags()
+
+	cobraCmd.PersistentFlags().StringVar(&result.branch, "branch", "", "branch the snapshot was built from")
+	cobraCmd.PersistentFlags().StringVar(&result.version, "version", "", "snapshot version to promote, including the build number")
+
+	return finalize(result)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	InTotoStatementType    = "https://in-toto.io/Statement/v0.1"
+	SlsaProvenanceType     = "https://slsa.dev/provenance/v0.2"
+	ProvenanceBuildType    = "https://github.com/netfoundry/ziti-ci/publish-to-artifactory@v1"
+	ProvenanceFileName     = "provenance.intoto.jsonl"
+	ProvenanceLocalBuilder = "local"
+)
+
+type provenanceStatement struct {
+	Type          string               `json:"_type"`
+	Subject       []*provenanceSubject `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     *provenancePredicate `json:"predicate"`
+}
+
+type provenanceSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type provenancePredicate struct {
+	Builder    *provenanceBuilder    `json:"builder"`
+	BuildType  string                `json:"buildType"`
+	Invocation *provenanceInvocation `json:"invocation"`
+	Metadata   *provenanceMetadata   `json:"metadata"`
+	Materials  []*provenanceMaterial `json:"materials"`
+}
+
+type provenanceBuilder struct {
+	Id string `json:"id"`
+}
+
+type provenanceInvocation struct {
+	ConfigSource *provenanceMaterial `json:"configSource"`
+}
+
+type provenanceMetadata struct {
+	BuildInvocationId string `json:"buildInvocationId"`
+}
+
+type provenanceMaterial struct {
+	Uri    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+// writeProvenance writes an in-toto statement with SLSA provenance for the given artifacts. Artifacts are named by
+// their artifactory destination, with the digest of the archive which is uploaded there
+func (cmd *publishToArtifactoryCmd) writeProvenance(provenancePath string, artifacts []*artifact, bundles []*artifact, version string) {
+	statement := &provenanceStatement{
+		Type:          InTotoStatementType,
+		PredicateType: SlsaProvenanceType,
+	}
+
+	for _, artifact := range artifacts {
+		statement.Subject = append(statement.Subject, &provenanceSubject{
+			Name:   cmd.getArtifactDest(artifact, version),
+			Digest: map[string]string{"sha256": artifact.sha256},
+		})
+	}
+	for _, bundle := range bundles {
+		statement.Subject = append(statement.Subject, &provenanceSubject{
+			Name:   cmd.getBundleDest(bundle, version),
+			Digest: map[string]string{"sha256": bundle.sha256},
+		})
+	}
+
+	builderId, runId := ProvenanceLocalBuilder, cmd.getBuildNumber()
+	if provider := cmd.getCiProvider(); provider != nil {
+		builderId, runId = provider.name, provider.getRunId()
+	}
+
+	source := &provenanceMaterial{
+		Uri:    "git+" + cmd.getSourceRepo(),
+		Digest: map[string]string{"sha1": cmd.getCmdOutputOneLine("get git SHA", "git", "rev-parse", "HEAD")},
+	}
+
+	statement.Predicate = &provenancePredicate{
+		Builder:    &provenanceBuilder{Id: builderId},
+		BuildType:  ProvenanceBuildType,
+		Invocation: &provenanceInvocation{ConfigSource: source},
+		Metadata:   &provenanceMetadata{BuildInvocationId: runId},
+		Materials:  []*provenanceMaterial{source},
+	}
+
+	// jsonl, so the statement must be on a single line
+	data, err := json.Marshal(statement)
+	if err != nil {
+		cmd.failf("unable to marshal provenance to json. err: %v\n", err)
+	}
+
+	if err = ioutil.WriteFile(provenancePath, append(data, '\n'), 0644); err != nil {
+		cmd.failf("unable to write provenance file %v. err: %v\n", provenancePath, err)
+	}
+}
+
+// getSourceRepo returns the url of the origin remote, falling back to the GitHub repository when there is no remote
+func (cmd *baseCommand) getSourceRepo() string {
+	cmd.logCommand("get git remote url", "git", "config", "--get", "remote.origin.url")
+	if output, err := exec.CommandContext(cmd.ctx, "git", "config", "--get", "remote.origin.url").Output(); err == nil {
+		if remote := strings.TrimSpace(string(output)); remote != "" {
+			return stripUrlCredentials(remote)
+		}
+	}
+	if repo, found := os.LookupEnv("GITHUB_REPOSITORY"); found && repo != "" {
+		return "https://github.com/" + repo
+	}
+	cmd.errorf("warning: unable to determine source repository url\n")
+	return "unknown"
+}
+
+// stripUrlCredentials removes any user and password from a remote url, since CI checkouts often embed a token there and
+// the provenance is published. scp style remotes (git@host:path) aren't urls and only carry a user name, so are kept
+func stripUrlCredentials(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil || u.User == nil {
+		return remote
+	}
+	u.User = nil
+	return u.String()
+}
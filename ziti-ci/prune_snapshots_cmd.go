@@ -0,0 +1,95 @@
+package main
+
+import (
+	"github.com/hashicorp/go-version"
+	"github.com/spf13/cobra"
+	"path"
+	"sort"
+)
+
+type pruneSnapshotsCmd struct {
+	artifactoryCommand
+	branch string
+	keep   int
+}
+
+func (cmd *pruneSnapshotsCmd) execute() {
+	if cmd.keep < 0 {
+		cmd.failf("--keep must not be negative\n")
+	}
+
+	if cmd.snapshotRepo == cmd.stagingRepo {
+		cmd.failf("snapshot repo and staging repo are both %v, refusing to prune\n", cmd.snapshotRepo)
+	}
+
+	if cmd.branch == "" {
+		cmd.branch = cmd.getCurrentBranch()
+	}
+
+	cmd.initJfrog()
+
+	results := cmd.search(cmd.snapshotRepo+"/"+cmd.branch+"/*", "")
+
+	pathsByVersion := map[string][]string{}
+	var versions []*version.Version
+	for _, result := range results {
+		versionString := path.Base(path.Dir(result.Path))
+		if propVersions, found := result.Props["version"]; found && len(propVersions) > 0 {
+			versionString = propVersions[0]
+		}
+		if _, found := pathsByVersion[versionString]; !found {
+			v, err := version.NewVersion(versionString)
+			if err != nil {
+				cmd.errorf("skipping %v, unable to parse version %v: %v\n", result.Path, versionString, err)
+				continue
+			}
+			versions = append(versions, v)
+		}
+		pathsByVersion[versionString] = append(pathsByVersion[versionString], result.Path)
+	}
+
+	sort.Sort(sort.Reverse(versionList(versions)))
+
+	if len(versions) <= cmd.keep {
+		cmd.infof("found %v snapshot versions for branch %v, nothing to prune\n", len(versions), cmd.branch)
+		return
+	}
+
+	for _, v := range versions[:cmd.keep] {
+		cmd.infof("keeping snapshot version %v\n", v.Original())
+	}
+
+	for _, v := range versions[cmd.keep:] {
+		cmd.infof("pruning snapshot version %v\n", v.Original())
+		for _, artifactPath := range pathsByVersion[v.Original()] {
+			cmd.runCommand("Delete "+artifactPath, "jfrog", "rt", "del", artifactPath,
+				"--quiet",
+				cmd.jfrogAuthFlag, cmd.jfrogAuthSecret,
+				"--url", cmd.artifactoryUrl)
+		}
+	}
+}
+
+func newPruneSnapshotsCmd(root *rootCommand) *cobra.Command {
+	cobraCmd := &cobra.Command{
+		Use:   "prune-snapshots",
+		Short: "Deletes all but the most recent snapshot versions for a branch",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	result := &pruneSnapshotsCmd{
+		artifactoryCommand: artifactoryCommand{
+			baseCommand: baseCommand{
+				rootCommand: root,
+				cmd:         cobraCmd,
+			},
+		},
+	}
+
+	result.addArtifactoryFlags()
+
+	cobraCmd.PersistentFlags().StringVar(&result.branch, "branch", "", "branch to prune snapshots for. Defaults to the current branch")
+	cobraCmd.PersistentFlags().IntVar(&result.keep, "keep", 5, "number of snapshot versions to keep")
+
+	return finalize(result)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+type publishDockerCmd struct {
+	baseCommand
+	dockerfile  string
+	registry    string
+	imageName   string
+	sourceImage string
+	cosign      bool
+}
+
+func (cmd *publishDockerCmd) execute() {
+	if cmd.imageName == "" {
+		cmd.failf("no image name provided\n")
+	}
+	if cmd.cosign {
+		cmd.requireCosign()
+	}
+
+	cmd.evalCurrentAndNextVersion()
+
+	version := cmd.getArtifactVersion()
+	image := cmd.imageName
+	if cmd.registry != "" {
+		image = cmd.registry + "/" + cmd.imageName
+	}
+
+	tags := []string{fmt.Sprintf("%v:%v", image, version)}
+	if cmd.isReleaseBranch() {
+		tags = append(tags, image+":latest")
+	}
+
+	if cmd.sourceImage != "" {
+		for _, tag := range tags {
+			cmd.runCommand("Tag image "+tag, "docker", "tag", cmd.sourceImage, tag)
+		}
+	} else {
+		params := []string{"build", "-f", cmd.dockerfile, "--build-arg", "VERSION=" + version}
+		for _, tag := range tags {
+			params = append(params, "-t", tag)
+		}
+		// the release dir is the build context, so the Dockerfile can copy binaries from <arch>/<os>/
+		params = append(params, cmd.getReleaseDir())
+		cmd.runCommand("Build image "+image, "docker", params...)
+	}
+
+	for _, tag := range tags {
+		cmd.runCommand("Push image "+tag, "docker", "push", tag)
+	}
+
+	if cmd.cosign {
+		cmd.signImage(tags[0])
+	}
+
+	cmd.summaryf("successfully published docker image %v\n", tags[0])
+}
+
+// signImage signs the pushed image by digest, so the signature applies to every tag of the image
+func (cmd *publishDockerCmd) signImage(tag string) {
+	if cmd.dryRun {
+		cmd.infof("dry run, not signing image %v\n", tag)
+		return
+	}
+	digest := cmd.getCmdOutputOneLine("get image digest", "docker", "inspect", "--format", "{{index .RepoDigests 0}}", tag)
+	cmd.runCommand("cosign image "+digest, "cosign", "sign", "--yes", digest)
+}
+
+func newPublishDockerCmd(root *rootCommand) *cobra.Command {
+	cobraCmd := &cobra.Command{
+		Use:   "publish-docker",
+		Short: "Builds docker images from the release binaries and pushes them to a registry",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	result := &publishDockerCmd{
+		baseCommand: baseCommand{
+			rootCommand: root,
+			cmd:         cobraCmd,
+		},
+	}
+
+	cobraCmd.PersistentFlags().StringVar(&result.releaseDir, "release-dir", DefaultReleaseDir, "set the directory used as the docker build context")
+	cobraCmd.PersistentFlags().StringVar(&result.dockerfile, "dockerfile", "Dockerfile", "set the Dockerfile used to build the image")
+	cobraCmd.PersistentFlags().StringVar(&result.registry, "registry", "", "set the registry to push to, e.g. docker.io/netfoundry. Defaults to docker hub")
+	cobraCmd.PersistentFlags().StringVar(&result.imageName, "image-name", "ziti", "set the image name, which is prefixed with the registry")
+	cobraCmd.PersistentFlags().BoolVar(&result.cosign, "cosign", false, "sign the pushed image digest with keyless cosign, using the CI job's OIDC identity")
+	cobraCmd.PersistentFlags().StringVar(&result.sourceImage, "source-image", "", "retag and push this existing image, instead of building one")
+
+	return finalize(result)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+const DefaultPublishStateFile = ".ziti-ci-publish-state.json"
+
+// publishState records the artifacts which have been completely uploaded, so a publish which died part way through can
+// be resumed with --resume without re-uploading them
+type publishState struct {
+	path string
+	lock sync.Mutex
+
+	// Completed maps <artifactory url>/<dest> to the sha256 of the archive uploaded there
+	Completed map[string]string `json:"completed"`
+}
+
+// loadPublishState reads the state left by a previous run, or starts with an empty state if there is none
+func (cmd *baseCommand) loadPublishState(statePath string) *publishState {
+	state := &publishState{
+		path:      statePath,
+		Completed: map[string]string{},
+	}
+
+	data, err := ioutil.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return state
+	}
+	if err != nil {
+		cmd.failf("unable to read publish state file %v. err: %v\n", statePath, err)
+	}
+	if err = json.Unmarshal(data, state); err != nil {
+		cmd.failf("unable to parse publish state file %v. err: %v\n", statePath, err)
+	}
+	if state.Completed == nil {
+		state.Completed = map[string]string{}
+	}
+	cmd.infof("resuming publish, %v uploads already completed according to %v\n", len(state.Completed), statePath)
+	return state
+}
+
+// isComplete returns true if an archive with the given sha256 was completely uploaded to dest by a previous run
+func (state *publishState) isComplete(target *artifactoryTarget, dest, sha256 string) bool {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return state.Completed[target.url+"/"+dest] == sha256
+}
+
+// markComplete records the upload and saves the state straight away, so it survives the publish dying
+func (cmd *baseCommand) markComplete(state *publishState, target *artifactoryTarget, dest, sha256 string) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.Completed[target.url+"/"+dest] = sha256
+
+	data, err := json.MarshalIndent(state, "", "    ")
+	if err != nil {
+		cmd.failf("unable to marshal publish state to json. err: %v\n", err)
+	}
+	if err = ioutil.WriteFile(state.path, data, 0644); err != nil {
+		cmd.failf("unable to write publish state file %v. err: %v\n", state.path, err)
+	}
+}
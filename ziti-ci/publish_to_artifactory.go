@@ -1,129 +1,816 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/spf13/cobra"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	PublishLogFile = "publish-log.txt"
+
+	// PublishLogFailureTimeout limits publishing the log of a failed publish, which can't rely on the command context
+	PublishLogFailureTimeout = 2 * time.Minute
 )
 
 type publishToArtifactoryCmd struct {
-	baseCommand
+	artifactoryCommand
+
+	uploadRetries  int
+	retryBaseDelay time.Duration
+	uploadTimeout  time.Duration
+
+	heartbeatInterval time.Duration
+
+	uploadConcurrency  int
+	concurrencyPerHost int
+
+	manifest     bool
+	provenance   bool
+	sign         bool
+	cosign       bool
+	kmsKeyId     string
+	failFast     bool
+	skipExisting bool
+	resume       bool
+	stateFile    string
+
+	// combinedChecksums controls whether a SHA256SUMS covering every artifact is published, and if so, whether it
+	// replaces the per-artifact checksum files
+	combinedChecksums string
+
+	buildName              string
+	publishBuildInfoAlways bool
+	publishLatest          bool
+	cleanupArchives        bool
+	uploadLog              bool
+	includeSource          bool
+
+	deb         bool
+	rpm         bool
+	packageInfo linuxPackageInfo
+
+	commit      string
+	extraProps  []string
+	props       string
+	contentType string
+
+	additionalTargets []string
+	targets           []*artifactoryTarget
+	// hostSlots limits the uploads running against each artifactory host to --concurrency-per-host, across all of the
+	// host's targets
+	hostSlots map[string]chan struct{}
+
+	logPath string
+	logFile *os.File
+
+	// generatedFiles holds files generated for the release as a whole, which --cleanup-archives also removes
+	generatedFiles []string
+
+	// state is shared by the per artifact copies of the command, and is only set with --resume
+	state *publishState
+
+	json bool
+	// bytesUploaded is shared by the per artifact copies of the command the upload workers use
+	bytesUploaded *int64
 }
 
-type artifact struct {
-	name            string
-	artifactArchive string
-	sourceName      string
-	sourcePath      string
-	artifactPath    string
-	arch            string
-	os              string
+// artifactoryTarget is an artifactory instance and repository which artifacts and bundles are published to
+type artifactoryTarget struct {
+	url     string
+	repo    string
+	primary bool
+}
+
+func (target *artifactoryTarget) String() string {
+	return target.url + "/" + target.repo
+}
+
+type publishSummary struct {
+	Artifacts     int            `json:"artifacts"`
+	Bundles       int            `json:"bundles"`
+	BytesUploaded int64          `json:"bytesUploaded"`
+	Targets       map[string]int `json:"targets"`
+	Version       string         `json:"version"`
+	Repo          string         `json:"repo"`
+	Elapsed       string         `json:"elapsed"`
+
+	PackagingFailures []string `json:"packagingFailures,omitempty"`
+}
+
+type manifestEntry struct {
+	Name    string `json:"name"`
+	Arch    string `json:"arch"`
+	Os      string `json:"os"`
+	Version string `json:"version"`
+	Archive string `json:"archive"`
+	Dest    string `json:"dest"`
+	Sha256  string `json:"sha256"`
 }
 
 func (cmd *publishToArtifactoryCmd) execute() {
-	jfrogApiKey, found := os.LookupEnv("JFROG_API_KEY")
-	if !found {
-		cmd.failf("JFROG_API_KEY not specified")
+	start := time.Now()
+	if cmd.json {
+		// keep stdout clean for the json summary, so it can be piped straight to a json parser
+		cmd.cmd.SetOut(os.Stderr)
+	}
+	if cmd.isReleaseBranch() {
+		cmd.requireCleanTree()
 	}
-
 	cmd.evalCurrentAndNextVersion()
 
-	cmd.runCommand("install jfrog cli", "go", "get", "github.com/jfrog/jfrog-cli-go/...")
-	releaseDir, err := filepath.Abs("./release")
-	cmd.exitIfErrf(err, "could not get absolute path for releases directory")
-
-	archDirs, err := ioutil.ReadDir(releaseDir)
-	cmd.exitIfErrf(err, "failed to read releases dir: %v\n", err)
-	var artifacts []*artifact
-	for _, archDir := range archDirs {
-		arch := archDir.Name()
-		cmd.infof("processing files for arch: %v\n", arch)
-		archDirPath := filepath.Join(releaseDir, archDir.Name())
-
-		if archDir.IsDir() {
-			osDirs, err := ioutil.ReadDir(archDirPath)
-			cmd.exitIfErrf(err, "failed to read arch dir %v: %v\n", archDirPath, err)
-
-			for _, osDir := range osDirs {
-				os := osDir.Name()
-				cmd.infof("processing files for: %v/%v\n", arch, os)
-
-				osDirPath := filepath.Join(archDirPath, osDir.Name())
-				releasableFiles, err := ioutil.ReadDir(osDirPath)
-				cmd.exitIfErrf(err, "failed to read os dir %v: %v\n", osDirPath, err)
-
-				for _, releasableFile := range releasableFiles {
-					if !releasableFile.IsDir() && !strings.HasSuffix(releasableFile.Name(), ".gz") {
-						name := releasableFile.Name()
-						if strings.HasSuffix(name, ".exe") {
-							name = strings.TrimSuffix(name, ".exe")
-						}
-						filePath := filepath.Join(osDirPath, releasableFile.Name())
-						destPath := filepath.Join(osDirPath, name+".tar.gz")
-						cmd.infof("packaging releasable: %v -> %v\n", filePath, destPath)
-						cmd.tarGzSimple(destPath, filePath)
-						artifacts = append(artifacts, &artifact{
-							name:            name,
-							sourceName:      releasableFile.Name(),
-							sourcePath:      filePath,
-							artifactArchive: name + ".tar.gz",
-							artifactPath:    destPath,
-							arch:            arch,
-							os:              os,
-						})
+	if cmd.buildName == "" {
+		cmd.failf("--build-name can't be empty\n")
+	}
+	cmd.props = cmd.formatExtraProps()
+	switch cmd.combinedChecksums {
+	case CombinedChecksumsNone, CombinedChecksumsAdd:
+	case CombinedChecksumsReplace:
+		cmd.checksumAlgorithms = nil
+	default:
+		cmd.failf("unsupported combined checksums mode: '%v'. Valid values: [%v, %v, %v]\n", cmd.combinedChecksums,
+			CombinedChecksumsNone, CombinedChecksumsAdd, CombinedChecksumsReplace)
+	}
+	cmd.targets = cmd.getTargets()
+	cmd.hostSlots = cmd.getHostSlots(cmd.targets)
+	cmd.initJfrog()
+	if cmd.resume {
+		cmd.state = cmd.loadPublishState(cmd.stateFile)
+	}
+	cmd.commit = cmd.getCmdOutputOneLine("get short git SHA", "git", "rev-parse", "--short", "HEAD")
+	releaseDir := cmd.getReleaseDir()
+	if cmd.uploadLog {
+		cmd.startLogCapture(releaseDir)
+		// a failed publish is when the log is most useful, so publish it on failure too. The command context may be
+		// why the publish failed, e.g. if --timeout expired, so the upload gets its own. It also bypasses the per host
+		// upload slots, which hung uploads may still be holding
+		version := cmd.getArtifactVersion()
+		failHook = func() {
+			ctx, cancel := context.WithTimeout(context.Background(), PublishLogFailureTimeout)
+			defer cancel()
+			logCmd := *cmd
+			logCmd.ctx = ctx
+			logCmd.hostSlots = nil
+			if err := logCmd.publishLog(version); err != nil {
+				cmd.errorf("unable to publish %v. err: %v\n", PublishLogFile, err)
+			}
+		}
+	}
+
+	if cmd.deb || cmd.rpm {
+		cmd.requireNfpm()
+	}
+	if cmd.cosign || cmd.kmsKeyId != "" {
+		cmd.requireCosign()
+	}
+
+	artifacts := cmd.collectArtifacts(releaseDir)
+	version := cmd.getArtifactVersion()
+
+	for _, artifact := range artifacts {
+		if artifact.os != "linux" {
+			continue
+		}
+		if cmd.deb {
+			artifact.debPath = cmd.buildLinuxPackage(artifact, PackagerDeb, version, &cmd.packageInfo)
+		}
+		if cmd.rpm {
+			artifact.rpmPath = cmd.buildLinuxPackage(artifact, PackagerRpm, version, &cmd.packageInfo)
+		}
+	}
+
+	bundles := cmd.getBundles(releaseDir, artifacts)
+	for _, bundle := range bundles {
+		cmd.tarGzArtifacts(bundle.artifactPath, bundle.contents...)
+		bundle.checksumPaths = cmd.writeChecksumFiles(bundle.artifactPath)
+		bundle.sha256 = cmd.sha256File(bundle.artifactPath)
+	}
+
+	if cmd.sign {
+		gpgHome := cmd.newGpgHome()
+		defer func() { _ = os.RemoveAll(gpgHome) }()
+
+		for _, artifact := range artifacts {
+			artifact.signaturePath = cmd.gpgSign(gpgHome, artifact.artifactPath)
+		}
+		for _, bundle := range bundles {
+			bundle.signaturePath = cmd.gpgSign(gpgHome, bundle.artifactPath)
+		}
+	}
+
+	if cmd.kmsKeyId != "" {
+		for _, artifact := range append(artifacts, bundles...) {
+			artifact.cosignSigPath = cmd.cosignSignBlobWithKms(cmd.kmsKeyId, artifact.artifactPath)
+		}
+	} else if cmd.cosign {
+		for _, artifact := range append(artifacts, bundles...) {
+			artifact.cosignSigPath, artifact.cosignCertPath = cmd.cosignSignBlob(artifact.artifactPath)
+		}
+	}
+
+	failures := cmd.uploadArtifacts(artifacts, version)
+
+	if cmd.manifest && !cmd.stopOnFailure(failures) {
+		manifestPath := filepath.Join(cmd.getOutputDir(releaseDir), "manifest.json")
+		cmd.writeManifest(manifestPath, artifacts, version)
+		cmd.generatedFiles = append(cmd.generatedFiles, manifestPath)
+		props := fmt.Sprintf("version=%v;branch=%v;commit=%v", version, cmd.getCurrentBranch(), cmd.commit)
+		if err := cmd.tryUpload("Publish manifest", manifestPath, cmd.getVersionRootDest(version)+"/manifest.json", props); err != nil {
+			failures = append(failures, fmt.Sprintf("manifest.json: %v", err))
+		}
+	}
+
+	if cmd.isReleaseBranch() {
+		for _, bundle := range bundles {
+			if cmd.stopOnFailure(failures) {
+				break
+			}
+			for _, target := range cmd.targets {
+				if err := cmd.uploadBundle(target, bundle, version); err != nil {
+					failures = append(failures, fmt.Sprintf("%v to %v: %v", bundle.artifactArchive, target, err))
+				}
+			}
+		}
+
+		if cmd.includeSource && !cmd.stopOnFailure(failures) {
+			if err := cmd.publishSourceArchive(releaseDir, version); err != nil {
+				failures = append(failures, fmt.Sprintf("source archive: %v", err))
+			}
+		}
+	}
+
+	if cmd.combinedChecksums != CombinedChecksumsNone && !cmd.stopOnFailure(failures) {
+		if err := cmd.publishCombinedChecksums(releaseDir, artifacts, bundles, version); err != nil {
+			failures = append(failures, fmt.Sprintf("%v: %v", CombinedChecksumsFile, err))
+		}
+	}
+
+	if cmd.provenance && !cmd.stopOnFailure(failures) {
+		// bundles are only published from release branches
+		var publishedBundles []*artifact
+		if cmd.isReleaseBranch() {
+			publishedBundles = bundles
+		}
+		provenancePath := filepath.Join(cmd.getOutputDir(releaseDir), ProvenanceFileName)
+		cmd.writeProvenance(provenancePath, artifacts, publishedBundles, version)
+		cmd.generatedFiles = append(cmd.generatedFiles, provenancePath)
+		props := fmt.Sprintf("version=%v;branch=%v;commit=%v", version, cmd.getCurrentBranch(), cmd.commit)
+		if err := cmd.tryUpload("Publish provenance", provenancePath, cmd.getVersionRootDest(version)+"/"+ProvenanceFileName, props); err != nil {
+			failures = append(failures, fmt.Sprintf("%v: %v", ProvenanceFileName, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		cmd.failf("failed to publish:\n%v\n", strings.Join(failures, "\n"))
+	}
+
+	// everything is published, so a later run has nothing to resume
+	if cmd.state != nil {
+		if err := os.Remove(cmd.stateFile); err != nil && !os.IsNotExist(err) {
+			cmd.errorf("warning: unable to remove publish state file %v. err: %v\n", cmd.stateFile, err)
+		}
+	}
+
+	// latest is only moved once the whole release is published
+	if cmd.publishLatest {
+		cmd.copyToLatest(artifacts, version)
+	}
+
+	if cmd.isReleaseBranch() || cmd.publishBuildInfoAlways {
+		cmd.runCommand("Set build version", "jfrog", "rt", "bce", cmd.getBuildName(), version)
+		cmd.runCommand("Create build in Artifactory", "jfrog", "rt", "bp",
+			cmd.jfrogAuthFlag, cmd.jfrogAuthSecret, "--url", cmd.artifactoryUrl, cmd.getBuildName(), version)
+	}
+
+	if cmd.cleanupArchives {
+		cmd.cleanup(append(artifacts, bundles...))
+	}
+
+	cmd.writeGithubOutputs([][2]string{
+		{"version", version},
+		{"is-release", fmt.Sprint(cmd.isReleaseBranch())},
+		{"build-number", cmd.getBuildNumber()},
+	})
+
+	cmd.printSummary(&publishSummary{
+		Artifacts:     len(artifacts),
+		Bundles:       len(bundles),
+		BytesUploaded: atomic.LoadInt64(cmd.bytesUploaded),
+		Targets:       countTargets(artifacts),
+		Version:       version,
+		Repo:          cmd.getPublishRepo(),
+		Elapsed:       time.Since(start).Round(time.Millisecond).String(),
+
+		PackagingFailures: cmd.packagingFailures,
+	})
+
+	if len(cmd.packagingFailures) > 0 {
+		cmd.failf("published the other artifacts, but failed to package:\n%v\n", strings.Join(cmd.packagingFailures, "\n"))
+	}
+
+	if cmd.uploadLog {
+		failHook = nil
+		if err := cmd.publishLog(version); err != nil {
+			cmd.failf("unable to publish %v. err: %v\n", PublishLogFile, err)
+		}
+	}
+}
+
+// startLogCapture starts copying everything logged to the publish log in the output dir
+func (cmd *publishToArtifactoryCmd) startLogCapture(releaseDir string) {
+	outputDir := cmd.getOutputDir(releaseDir)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		cmd.failf("unable to create output dir %v. err: %v\n", outputDir, err)
+	}
+	cmd.logPath = filepath.Join(outputDir, PublishLogFile)
+	file, err := os.Create(cmd.logPath)
+	if err != nil {
+		cmd.failf("unable to create publish log %v. err: %v\n", cmd.logPath, err)
+	}
+	cmd.logFile = file
+	setLogCapture(file)
+}
+
+// publishLog stops capturing the log and uploads it to the version root. Secrets are already redacted, as the log
+// gets exactly what is logged to the console
+func (cmd *publishToArtifactoryCmd) publishLog(version string) error {
+	setLogCapture(nil)
+	cmd.close(cmd.logFile, "publish log "+cmd.logPath)
+	props := fmt.Sprintf("version=%v;branch=%v;commit=%v", version, cmd.getCurrentBranch(), cmd.commit)
+	return cmd.tryUpload("Publish log", cmd.logPath, cmd.getVersionRootDest(version)+"/"+PublishLogFile, props)
+}
+
+func (cmd *publishToArtifactoryCmd) printSummary(summary *publishSummary) {
+	if cmd.json {
+		data, err := json.Marshal(summary)
+		if err != nil {
+			cmd.failf("unable to marshal publish summary to json. err: %v\n", err)
+		}
+		_, _ = fmt.Fprintln(os.Stdout, string(data))
+		return
+	}
+
+	var targets []string
+	for target := range summary.Targets {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	if len(summary.PackagingFailures) > 0 {
+		cmd.summaryf("published %v artifacts and %v bundles to %v as version %v, but failed to package %v files\n", summary.Artifacts, summary.Bundles, summary.Repo, summary.Version, len(summary.PackagingFailures))
+	} else {
+		cmd.summaryf("successfully published %v artifacts and %v bundles to %v as version %v\n", summary.Artifacts, summary.Bundles, summary.Repo, summary.Version)
+	}
+	cmd.summaryf("  uploaded %v bytes in %v\n", summary.BytesUploaded, summary.Elapsed)
+	for _, target := range targets {
+		cmd.summaryf("  %v: %v artifacts\n", target, summary.Targets[target])
+	}
+}
+
+// countTargets returns the number of artifacts for each arch/os target
+func countTargets(artifacts []*artifact) map[string]int {
+	result := map[string]int{}
+	for _, artifact := range artifacts {
+		result[artifact.arch+"/"+artifact.os]++
+	}
+	return result
+}
+
+// getBuildName returns the artifactory build name uploads are associated with. Snapshot builds are kept separate, with
+// a -snapshot suffix, so they don't show up amongst the release builds
+func (cmd *publishToArtifactoryCmd) getBuildName() string {
+	if cmd.isReleaseBranch() {
+		return cmd.buildName
+	}
+	return cmd.buildName + "-snapshot"
+}
+
+// stopOnFailure returns true if publishing should stop because of earlier failures. Without fail fast, everything
+// which can be published is, and the failures are reported at the end
+func (cmd *publishToArtifactoryCmd) stopOnFailure(failures []string) bool {
+	return cmd.failFast && len(failures) > 0
+}
+
+// uploadArtifacts publishes the given artifacts using a pool of uploadConcurrency workers, and returns a description of
+// each failed upload. With fail fast, no new uploads are started once one has failed
+func (cmd *publishToArtifactoryCmd) uploadArtifacts(artifacts []*artifact, version string) []string {
+	artifactC := make(chan *artifact, len(artifacts))
+	for _, artifact := range artifacts {
+		artifactC <- artifact
+	}
+	close(artifactC)
+
+	workers := cmd.uploadConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	var failures []string
+	failuresLock := sync.Mutex{}
+	waitGroup := sync.WaitGroup{}
+
+	for i := 0; i < workers; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for artifact := range artifactC {
+				failuresLock.Lock()
+				stop := cmd.stopOnFailure(failures)
+				failuresLock.Unlock()
+				if stop {
+					continue
+				}
+				// each upload logs through its own copy of the command, so its lines can be prefixed with the artifact
+				worker := *cmd
+				worker.logPrefix = fmt.Sprintf("[%v %v/%v] ", artifact.name, artifact.arch, artifact.os)
+				for _, target := range cmd.targets {
+					if err := worker.uploadArtifact(target, artifact, version); err != nil {
+						failuresLock.Lock()
+						failures = append(failures, fmt.Sprintf("%v (%v/%v) to %v: %v", artifact.name, artifact.arch, artifact.os, target, err))
+						failuresLock.Unlock()
 					}
 				}
 			}
+		}()
+	}
+
+	waitGroup.Wait()
+
+	return failures
+}
+
+func (cmd *publishToArtifactoryCmd) uploadArtifact(target *artifactoryTarget, artifact *artifact, version string) error {
+	dest := target.repo + "/" + cmd.getArtifactRepoPath(artifact, version)
+	if cmd.skipExisting && cmd.isPublished(target.url, dest, artifact.sha256) {
+		cmd.infof("%v already published with matching sha256, skipping\n", dest)
+		return nil
+	}
+	if cmd.state != nil && cmd.state.isComplete(target, dest, artifact.sha256) {
+		cmd.infof("%v already uploaded by a previous run, skipping\n", dest)
+		return nil
+	}
+	props := fmt.Sprintf("version=%v;name=%v;arch=%v;os=%v;branch=%v;commit=%v", version, artifact.name, artifact.arch, artifact.os, cmd.getCurrentBranch(), cmd.commit)
+	if err := cmd.uploadArtifactFiles(target, artifact, dest, props); err != nil {
+		return err
+	}
+	cmd.recordUpload(target, dest, artifact.sha256)
+	return nil
+}
+
+// uploadArtifactFiles uploads the archive for the artifact to dest, along with its checksums, signatures and packages
+func (cmd *publishToArtifactoryCmd) uploadArtifactFiles(target *artifactoryTarget, artifact *artifact, dest string, props string) error {
+	if err := cmd.tryUploadTo(target, fmt.Sprintf("Publish artifact for %v", artifact.name), artifact.artifactPath, dest, props); err != nil {
+		return err
+	}
+	for _, checksumPath := range artifact.checksumPaths {
+		if err := cmd.tryUploadTo(target, fmt.Sprintf("Publish checksum for %v", artifact.name), checksumPath, dest+filepath.Ext(checksumPath), props); err != nil {
+			return err
+		}
+	}
+	if artifact.signaturePath != "" {
+		if err := cmd.tryUploadTo(target, fmt.Sprintf("Publish signature for %v", artifact.name), artifact.signaturePath, dest+".asc", props); err != nil {
+			return err
 		}
 	}
+	if err := cmd.uploadCosignSignature(target, artifact, dest, props); err != nil {
+		return err
+	}
+	if artifact.debPath != "" {
+		debDest := path.Join(path.Dir(dest), filepath.Base(artifact.debPath))
+		if err := cmd.tryUploadTo(target, fmt.Sprintf("Publish deb for %v", artifact.name), artifact.debPath, debDest, props); err != nil {
+			return err
+		}
+	}
+	// the rpm repository is only configured for the primary artifactory
+	if artifact.rpmPath != "" && cmd.isReleaseBranch() && target.primary {
+		if err := cmd.tryUploadTo(target, fmt.Sprintf("Publish rpm for %v", artifact.name), artifact.rpmPath, cmd.getRpmDest(artifact.rpmPath), props); err != nil {
+			return err
+		}
+	}
+	if artifact.sbomPath != "" {
+		sbomDest := path.Join(path.Dir(dest), artifact.name+".cdx.json")
+		return cmd.tryUploadTo(target, fmt.Sprintf("Publish sbom for %v", artifact.name), artifact.sbomPath, sbomDest, props)
+	}
+	return nil
+}
 
-	zitiAllPath := "release/ziti-all.tar.gz"
-	cmd.tarGzArtifacts(zitiAllPath, artifacts...)
+func (cmd *publishToArtifactoryCmd) uploadBundle(target *artifactoryTarget, bundle *artifact, version string) error {
+	dest := target.repo + "/" + cmd.getBundleRepoPath(bundle, version)
+	if cmd.skipExisting && cmd.isPublished(target.url, dest, bundle.sha256) {
+		cmd.infof("%v already published with matching sha256, skipping\n", dest)
+		return nil
+	}
+	if cmd.state != nil && cmd.state.isComplete(target, dest, bundle.sha256) {
+		cmd.infof("%v already uploaded by a previous run, skipping\n", dest)
+		return nil
+	}
+	props := fmt.Sprintf("version=%v;branch=%v;commit=%v", version, cmd.getCurrentBranch(), cmd.commit)
+	if bundle.arch != "" {
+		props = fmt.Sprintf("%v;arch=%v;os=%v", props, bundle.arch, bundle.os)
+	}
+	if err := cmd.tryUploadTo(target, "Publish artifact for "+bundle.artifactArchive, bundle.artifactPath, dest, props); err != nil {
+		return err
+	}
+	for _, checksumPath := range bundle.checksumPaths {
+		if err := cmd.tryUploadTo(target, "Publish checksum for "+bundle.artifactArchive, checksumPath, dest+filepath.Ext(checksumPath), props); err != nil {
+			return err
+		}
+	}
+	if bundle.signaturePath != "" {
+		if err := cmd.tryUploadTo(target, "Publish signature for "+bundle.artifactArchive, bundle.signaturePath, dest+".asc", props); err != nil {
+			return err
+		}
+	}
+	if err := cmd.uploadCosignSignature(target, bundle, dest, props); err != nil {
+		return err
+	}
+	cmd.recordUpload(target, dest, bundle.sha256)
+	return nil
+}
+
+// recordUpload marks dest as completely uploaded in the --resume state. Dry runs upload nothing, so record nothing
+func (cmd *publishToArtifactoryCmd) recordUpload(target *artifactoryTarget, dest, sha256 string) {
+	if cmd.state != nil && !cmd.dryRun {
+		cmd.markComplete(cmd.state, target, dest, sha256)
+	}
+}
 
-	// When rolling minor/major numbers the current version will be nil, so use the next version instead
-	// This will only happen when publishing a PR
-	version := cmd.getPublishVersion().String()
-	if cmd.getCurrentBranch() != "master" {
-		version = fmt.Sprintf("%v-%v", version, cmd.getBuildNumber())
+func (cmd *publishToArtifactoryCmd) uploadCosignSignature(target *artifactoryTarget, artifact *artifact, dest string, props string) error {
+	if artifact.cosignSigPath == "" {
+		return nil
+	}
+	if err := cmd.tryUploadTo(target, "Publish cosign signature for "+artifact.artifactArchive, artifact.cosignSigPath, dest+".sig", props); err != nil {
+		return err
 	}
+	// kms signatures are verified with the kms public key, so have no certificate
+	if artifact.cosignCertPath == "" {
+		return nil
+	}
+	return cmd.tryUploadTo(target, "Publish cosign certificate for "+artifact.artifactArchive, artifact.cosignCertPath, dest+".pem", props)
+}
 
+// copyToLatest copies each published artifact, with its checksums and signatures, to the latest path, replacing the
+// previous release there. Only releases are copied, never snapshots or prereleases
+func (cmd *publishToArtifactoryCmd) copyToLatest(artifacts []*artifact, version string) {
+	if !cmd.isReleaseBranch() || cmd.getPublishVersion().Prerelease() != "" {
+		cmd.infof("version %v is not a release, so not updating latest\n", version)
+		return
+	}
+
+	var failures []string
 	for _, artifact := range artifacts {
-		dest := ""
-		// if release branch, publish to staging, otherwise to snapshot
-		if cmd.getCurrentBranch() == "master" {
-			dest = fmt.Sprintf("ziti-staging/%v/%v/%v/%v/%v",
-				artifact.name, artifact.arch, artifact.os, version, artifact.artifactArchive)
-		} else {
-			dest = fmt.Sprintf("ziti-snapshot/%v/%v/%v/%v/%v/%v",
-				cmd.getCurrentBranch(), artifact.name, artifact.arch, artifact.os, version, artifact.artifactArchive)
-		}
-		props := fmt.Sprintf("version=%v;name=%v;arch=%v;os=%v;branch=%v", version, artifact.name, artifact.arch, artifact.os, cmd.getCurrentBranch())
-		cmd.runCommand(fmt.Sprintf("Publish artifact for %v", artifact.name),
-			"jfrog", "rt", "u", artifact.artifactPath, dest,
-			"--apikey", jfrogApiKey,
-			"--url", "https://netfoundry.jfrog.io/netfoundry",
-			"--props", props,
-			"--build-name=ziti",
-			"--build-number="+cmd.getPublishVersion().String())
-	}
-
-	if cmd.getCurrentBranch() == "master" {
-		dest := fmt.Sprintf("ziti-staging/ziti-all/%v/ziti-all.%v.tar.gz", version, version)
-		props := fmt.Sprintf("version=%v;branch=%v", version, cmd.getCurrentBranch())
-		cmd.runCommand("Publish artifact for ziti-all",
-			"jfrog", "rt", "u", zitiAllPath, dest,
-			"--apikey", jfrogApiKey,
-			"--url", "https://netfoundry.jfrog.io/netfoundry",
-			"--props", props,
-			"--build-name=ziti",
-			"--build-number="+cmd.getPublishVersion().String())
-
-		cmd.runCommand("Set build version", "jfrog", "rt", "bce", "ziti", version)
-		cmd.runCommand("Create build in Artifactory", "jfrog", "rt", "bp",
-			"--apikey", jfrogApiKey, "--url", "https://netfoundry.jfrog.io/netfoundry", "ziti", version)
+		dest := cmd.getArtifactDest(artifact, version)
+		latestDest := cmd.getArtifactDest(artifact, "latest")
+
+		suffixes := []string{""}
+		for _, checksumPath := range artifact.checksumPaths {
+			suffixes = append(suffixes, filepath.Ext(checksumPath))
+		}
+		if artifact.signaturePath != "" {
+			suffixes = append(suffixes, ".asc")
+		}
+		if artifact.cosignSigPath != "" {
+			suffixes = append(suffixes, ".sig")
+		}
+		if artifact.cosignCertPath != "" {
+			suffixes = append(suffixes, ".pem")
+		}
+
+		for _, suffix := range suffixes {
+			err := cmd.tryRunCommandWithRetry("Copy to latest "+dest+suffix, cmd.uploadRetries, cmd.retryBaseDelay, cmd.uploadTimeout,
+				"jfrog", "rt", "cp", dest+suffix, latestDest+suffix,
+				"--flat",
+				cmd.jfrogAuthFlag, cmd.jfrogAuthSecret,
+				"--url", cmd.artifactoryUrl)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%v: %v", dest+suffix, err))
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		cmd.failf("failed to update latest:\n%v\n", strings.Join(failures, "\n"))
+	}
+}
+
+// publishCombinedChecksums writes and uploads a SHA256SUMS covering every published artifact, listed by their path
+// relative to the root of the repository
+func (cmd *publishToArtifactoryCmd) publishCombinedChecksums(releaseDir string, artifacts, bundles []*artifact, version string) error {
+	digests := map[string]string{}
+	for _, artifact := range artifacts {
+		digests[cmd.getArtifactRepoPath(artifact, version)] = artifact.sha256
+	}
+	// bundles are only published from release branches
+	if cmd.isReleaseBranch() {
+		for _, bundle := range bundles {
+			digests[cmd.getBundleRepoPath(bundle, version)] = bundle.sha256
+		}
+	}
+
+	checksumsPath := filepath.Join(cmd.getOutputDir(releaseDir), CombinedChecksumsFile)
+	cmd.writeCombinedChecksumsFile(checksumsPath, digests)
+	cmd.generatedFiles = append(cmd.generatedFiles, checksumsPath)
+
+	props := fmt.Sprintf("version=%v;branch=%v;commit=%v", version, cmd.getCurrentBranch(), cmd.commit)
+	return cmd.tryUpload("Publish combined checksums", checksumsPath, cmd.getVersionRootDest(version)+"/"+CombinedChecksumsFile, props)
+}
+
+// cleanup removes the archives, checksums and other files generated while publishing, leaving the release dir as it
+// was before
+func (cmd *publishToArtifactoryCmd) cleanup(artifacts []*artifact) {
+	files := cmd.generatedFiles
+	for _, artifact := range artifacts {
+		files = append(files, artifact.getGeneratedFiles()...)
+	}
+	for _, file := range files {
+		cmd.infof("removing generated file %v\n", file)
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			cmd.errorf("warning: unable to remove generated file %v. err: %v\n", file, err)
+		}
+	}
+}
+
+// publishSourceArchive publishes an archive of the source at HEAD. git archive is used so that export-ignore rules in
+// .gitattributes are respected
+func (cmd *publishToArtifactoryCmd) publishSourceArchive(releaseDir string, version string) error {
+	name := fmt.Sprintf("ziti-src-%v", version)
+	archivePath := filepath.Join(cmd.getOutputDir(releaseDir), name+".tar.gz")
+	cmd.runGitCommandAlways("create source archive", "archive", "--format=tar.gz", "--prefix="+name+"/", "-o", archivePath, "HEAD")
+	cmd.generatedFiles = append(cmd.generatedFiles, archivePath)
+
+	dest := fmt.Sprintf("%v/ziti-src/%v/%v.tar.gz", cmd.stagingRepo, version, name)
+	props := fmt.Sprintf("version=%v;branch=%v;commit=%v", version, cmd.getCurrentBranch(), cmd.commit)
+	if err := cmd.tryUpload("Publish source archive", archivePath, dest, props); err != nil {
+		return err
+	}
+	checksumPaths := cmd.writeChecksumFiles(archivePath)
+	cmd.generatedFiles = append(cmd.generatedFiles, checksumPaths...)
+	for _, checksumPath := range checksumPaths {
+		if err := cmd.tryUpload("Publish checksum for source archive", checksumPath, dest+filepath.Ext(checksumPath), props); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cmd *publishToArtifactoryCmd) writeManifest(manifestPath string, artifacts []*artifact, version string) {
+	var entries []*manifestEntry
+	for _, artifact := range artifacts {
+		entries = append(entries, &manifestEntry{
+			Name:    artifact.name,
+			Arch:    artifact.arch,
+			Os:      artifact.os,
+			Version: version,
+			Archive: artifact.artifactArchive,
+			Dest:    cmd.getArtifactDest(artifact, version),
+			Sha256:  artifact.sha256,
+		})
+	}
+
+	data, err := json.MarshalIndent(entries, "", "    ")
+	if err != nil {
+		cmd.failf("unable to marshal manifest to json. err: %v\n", err)
+	}
+
+	if err = ioutil.WriteFile(manifestPath, data, 0644); err != nil {
+		cmd.failf("unable to write manifest file %v. err: %v\n", manifestPath, err)
+	}
+}
+
+// formatExtraProps validates the --prop values and returns them in jfrog-cli's ; separated props format
+func (cmd *publishToArtifactoryCmd) formatExtraProps() string {
+	var props []string
+	for _, prop := range cmd.extraProps {
+		parts := strings.SplitN(prop, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			cmd.failf("invalid --prop value '%v'. expected format: key=value\n", prop)
+		}
+		props = append(props, escapePropValue(parts[0])+"="+escapePropValue(parts[1]))
+	}
+	return strings.Join(props, ";")
+}
+
+// escapePropValue escapes the characters jfrog-cli uses to separate props and multiple prop values
+func escapePropValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`).Replace(value)
+}
+
+// getTargets returns the primary artifactory repository followed by any --additional-target repositories
+func (cmd *publishToArtifactoryCmd) getTargets() []*artifactoryTarget {
+	targets := []*artifactoryTarget{{url: cmd.artifactoryUrl, repo: cmd.getPublishRepo(), primary: true}}
+	for _, additionalTarget := range cmd.additionalTargets {
+		// the url contains a : itself, so split on the last one
+		idx := strings.LastIndex(additionalTarget, ":")
+		if idx < 1 || idx == len(additionalTarget)-1 || !strings.Contains(additionalTarget[:idx], "://") {
+			cmd.failf("invalid --additional-target value '%v'. expected format: <repo-url>:<repo-name>\n", additionalTarget)
+		}
+		targets = append(targets, &artifactoryTarget{url: additionalTarget[:idx], repo: additionalTarget[idx+1:]})
+	}
+	return targets
+}
+
+// getHostSlots returns a semaphore for each host the targets are on, sized to --concurrency-per-host. This defaults to
+// --upload-concurrency, so is only a tighter limit when given explicitly
+func (cmd *publishToArtifactoryCmd) getHostSlots(targets []*artifactoryTarget) map[string]chan struct{} {
+	limit := cmd.concurrencyPerHost
+	if limit < 1 {
+		limit = cmd.uploadConcurrency
+	}
+	if limit < 1 {
+		limit = 1
+	}
+
+	result := map[string]chan struct{}{}
+	for _, target := range targets {
+		host := getTargetHost(target)
+		if _, found := result[host]; !found {
+			result[host] = make(chan struct{}, limit)
+		}
+	}
+	return result
+}
+
+func getTargetHost(target *artifactoryTarget) string {
+	if targetUrl, err := url.Parse(target.url); err == nil && targetUrl.Host != "" {
+		return targetUrl.Host
+	}
+	return target.url
+}
+
+func (cmd *publishToArtifactoryCmd) tryUpload(description, source, dest, props string) error {
+	return cmd.tryUploadTo(cmd.targets[0], description, source, dest, props)
+}
+
+func (cmd *publishToArtifactoryCmd) tryUploadTo(target *artifactoryTarget, description, source, dest, props string) error {
+	if cmd.props != "" {
+		props += ";" + cmd.props
+	}
+	// jfrog-cli guesses the content type otherwise, which the CDN then serves
+	props += ";artifactory.content-type=" + cmd.getUploadContentType(source)
+	params := []string{"rt", "u", source, dest,
+		cmd.jfrogAuthFlag, cmd.jfrogAuthSecret,
+		"--url", target.url,
+		"--props", props,
+	}
+	// build info is only published to the primary artifactory, so only its uploads belong to the build
+	if target.primary {
+		params = append(params, "--build-name="+cmd.getBuildName(), "--build-number="+cmd.getArtifactVersion())
+	} else {
+		description += " to " + target.url
+	}
+
+	if slots, found := cmd.hostSlots[getTargetHost(target)]; found {
+		slots <- struct{}{}
+		defer func() { <-slots }()
+	}
+
+	if cmd.heartbeatInterval > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go cmd.heartbeat(done, source)
+	}
+	err := cmd.tryRunCommandWithRetry(description, cmd.uploadRetries, cmd.retryBaseDelay, cmd.uploadTimeout, "jfrog", params...)
+	if err == nil {
+		if info, statErr := os.Stat(source); statErr == nil {
+			atomic.AddInt64(cmd.bytesUploaded, info.Size())
+		}
+	}
+	return err
+}
+
+// getUploadContentType returns the content type to publish source with. --content-type overrides it for tar archives
+func (cmd *publishToArtifactoryCmd) getUploadContentType(source string) string {
+	name := filepath.Base(source)
+	if cmd.contentType != "" && strings.HasSuffix(name, cmd.archiveExtension()) {
+		return cmd.contentType
+	}
+	return getFileContentType(name)
+}
+
+// heartbeat logs that the upload of source is still in progress every heartbeatInterval, until done is closed, so
+// long uploads don't look hung
+func (cmd *publishToArtifactoryCmd) heartbeat(done <-chan struct{}, source string) {
+	start := time.Now()
+	ticker := time.NewTicker(cmd.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			cmd.infof("still uploading %v ... %v elapsed\n", filepath.Base(source), time.Since(start).Round(time.Second))
+		}
 	}
 }
 
@@ -135,11 +822,55 @@ func newPublishToArtifactoryCmd(root *rootCommand) *cobra.Command {
 	}
 
 	result := &publishToArtifactoryCmd{
-		baseCommand: baseCommand{
-			rootCommand: root,
-			cmd:         cobraCmd,
+		artifactoryCommand: artifactoryCommand{
+			baseCommand: baseCommand{
+				rootCommand: root,
+				cmd:         cobraCmd,
+			},
 		},
+		bytesUploaded: new(int64),
 	}
 
+	result.addArtifactoryFlags()
+	result.addReleaseFlags()
+	result.addBundleFlags()
+	cobraCmd.PersistentFlags().IntVar(&result.uploadRetries, "upload-retries", 3, "number of times to retry a failed artifact upload")
+	cobraCmd.PersistentFlags().DurationVar(&result.retryBaseDelay, "retry-base-delay", 2*time.Second, "delay before the first upload retry. Doubles with each subsequent retry")
+	cobraCmd.PersistentFlags().DurationVar(&result.uploadTimeout, "upload-timeout", 0, "kill and retry any single upload which takes longer than the given duration. 0 means no timeout")
+	cobraCmd.PersistentFlags().DurationVar(&result.heartbeatInterval, "heartbeat-interval", 30*time.Second, "log that an upload is still in progress at this interval. 0 disables the heartbeat")
+	cobraCmd.PersistentFlags().IntVar(&result.uploadConcurrency, "upload-concurrency", 4, "maximum number of artifact uploads to run in parallel")
+	cobraCmd.PersistentFlags().IntVar(&result.concurrencyPerHost, "concurrency-per-host", 0,
+		"maximum number of uploads to run in parallel against a single artifactory host, across all of its targets. Defaults to --upload-concurrency")
+	cobraCmd.PersistentFlags().BoolVar(&result.failFast, "fail-fast", true, "stop publishing at the first failed upload. If false, publish everything possible and report all failures at the end")
+	cobraCmd.PersistentFlags().StringVar(&result.buildName, "build-name", "ziti", "set the artifactory build name uploads and build info are published under")
+	cobraCmd.PersistentFlags().BoolVar(&result.publishBuildInfoAlways, "publish-build-info-always", false, "publish build info from all branches, not just release branches. Snapshot builds are published as <build-name>-snapshot")
+	cobraCmd.PersistentFlags().BoolVar(&result.publishLatest, "publish-latest", false, "also copy release artifacts to a latest path, in place of the version, replacing the previous release")
+	cobraCmd.PersistentFlags().StringVar(&result.contentType, "content-type", "", "set the content type tar archives are served with, instead of the type for their compression, e.g. application/gzip for .tar.gz")
+	cobraCmd.PersistentFlags().BoolVar(&result.continueOnPackagingError, "continue-on-packaging-error", false,
+		"on snapshot builds, leave out artifacts which fail to package and publish the rest, failing once done. Release builds always stop on packaging errors")
+	cobraCmd.PersistentFlags().BoolVar(&result.uploadLog, "upload-log", false, "capture the log of the publish, with secrets redacted, and publish it to the version root as "+PublishLogFile+", even if the publish fails")
+	cobraCmd.PersistentFlags().BoolVar(&result.cleanupArchives, "cleanup-archives", false, "delete the generated archives, checksums and signatures after a successful publish")
+	cobraCmd.PersistentFlags().BoolVar(&result.includeSource, "include-source", false, "also publish a source archive of HEAD from release branches")
+	cobraCmd.PersistentFlags().BoolVar(&result.allowDirty, "allow-dirty", false, "publish from a release branch even if tracked files have uncommitted changes")
+	cobraCmd.PersistentFlags().BoolVar(&result.skipExisting, "skip-existing", false, "don't upload artifacts which are already published with the same sha256")
+	cobraCmd.PersistentFlags().BoolVar(&result.resume, "resume", false, "record completed uploads in the state file and skip those already completed by a previous run. The state file is removed once everything is published")
+	cobraCmd.PersistentFlags().StringVar(&result.stateFile, "state-file", DefaultPublishStateFile, "set the state file used by --resume")
+	cobraCmd.PersistentFlags().BoolVar(&result.deb, "deb", false, "also package linux artifacts as .deb files using nfpm, and publish them alongside the archives")
+	cobraCmd.PersistentFlags().BoolVar(&result.rpm, "rpm", false, "also package linux artifacts as .rpm files using nfpm, and publish them to the rpm repository from release branches")
+	cobraCmd.PersistentFlags().StringVar(&result.packageInfo.maintainer, "package-maintainer", "NetFoundry <ziti-ci@netfoundry.io>", "set the maintainer of generated linux packages")
+	cobraCmd.PersistentFlags().StringVar(&result.packageInfo.description, "package-description", "Ziti", "set the description of generated linux packages")
+	cobraCmd.PersistentFlags().StringVar(&result.packageInfo.homepage, "package-homepage", "https://github.com/openziti", "set the homepage of generated linux packages")
+	cobraCmd.PersistentFlags().StringArrayVar(&result.additionalTargets, "additional-target", nil,
+		"also publish artifacts and bundles to the given <repo-url>:<repo-name>, e.g. a public mirror. May be repeated")
+	cobraCmd.PersistentFlags().StringArrayVar(&result.extraProps, "prop", nil, "add a key=value prop to every uploaded file. May be repeated")
+	cobraCmd.PersistentFlags().BoolVar(&result.json, "json", false, "output the final publish summary as json on stdout. Everything else is logged to stderr")
+	cobraCmd.PersistentFlags().BoolVar(&result.manifest, "manifest", false, "write and publish a manifest.json describing all published artifacts")
+	cobraCmd.PersistentFlags().StringVar(&result.combinedChecksums, "combined-checksums", CombinedChecksumsNone,
+		"publish a single "+CombinedChecksumsFile+" covering every artifact to the version root. Valid values: [none, add, replace]. replace skips the per-artifact checksum files")
+	cobraCmd.PersistentFlags().BoolVar(&result.provenance, "provenance", false, "write and publish an in-toto SLSA provenance statement for all published artifacts as "+ProvenanceFileName)
+	cobraCmd.PersistentFlags().BoolVar(&result.cosign, "cosign", false, "sign artifacts with keyless cosign, using the CI job's OIDC identity, and publish the .sig and .pem alongside them")
+	cobraCmd.PersistentFlags().StringVar(&result.kmsKeyId, "kms-key-id", "", "sign artifacts with cosign using the given AWS KMS key id, ARN or alias, instead of keylessly, and publish the .sig alongside them")
+	cobraCmd.PersistentFlags().BoolVar(&result.sign, "sign", false, "sign artifacts with the base64 encoded gpg key found in the "+GpgSigningKeyEnvVar+" env var")
+
 	return finalize(result)
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+const AzureConnectionStringEnvVar = "AZURE_STORAGE_CONNECTION_STRING"
+
+type publishToAzureCmd struct {
+	baseCommand
+	container      string
+	prefix         string
+	snapshotPrefix string
+}
+
+func (cmd *publishToAzureCmd) execute() {
+	if cmd.container == "" {
+		cmd.failf("no azure storage container provided\n")
+	}
+	// az reads the connection string from the environment, so it never appears on the command line
+	if _, found := os.LookupEnv(AzureConnectionStringEnvVar); !found {
+		cmd.failf("%v not specified\n", AzureConnectionStringEnvVar)
+	}
+
+	cmd.evalCurrentAndNextVersion()
+
+	artifacts := cmd.collectArtifacts(cmd.getReleaseDir())
+	version := cmd.getArtifactVersion()
+
+	for _, artifact := range artifacts {
+		blob := cmd.getBlobName(artifact, version)
+		cmd.uploadBlob(fmt.Sprintf("Publish artifact for %v", artifact.name), artifact.artifactPath, blob)
+		for _, checksumPath := range artifact.checksumPaths {
+			cmd.uploadBlob(fmt.Sprintf("Publish checksum for %v", artifact.name), checksumPath, blob+filepath.Ext(checksumPath))
+		}
+	}
+
+	cmd.summaryf("successfully published %v artifacts to azure container %v\n", len(artifacts), cmd.container)
+}
+
+func (cmd *publishToAzureCmd) uploadBlob(description string, file string, blob string) {
+	cmd.runCommand(description, "az", "storage", "blob", "upload",
+		"--container-name", cmd.container,
+		"--name", blob,
+		"--file", file,
+		"--overwrite", "true",
+		"--only-show-errors")
+}
+
+func (cmd *publishToAzureCmd) getBlobName(artifact *artifact, version string) string {
+	prefix := cmd.prefix
+	if !cmd.isReleaseBranch() {
+		prefix = cmd.snapshotPrefix
+	}
+	return fmt.Sprintf("%v/%v", prefix, cmd.getArtifactSubPath(artifact, version))
+}
+
+func newPublishToAzureCmd(root *rootCommand) *cobra.Command {
+	cobraCmd := &cobra.Command{
+		Use:   "publish-to-azure",
+		Short: "Publishes artifacts to an Azure Blob Storage container, using the " + AzureConnectionStringEnvVar + " env var",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	result := &publishToAzureCmd{
+		baseCommand: baseCommand{
+			rootCommand: root,
+			cmd:         cobraCmd,
+		},
+	}
+
+	result.addReleaseFlags()
+
+	cobraCmd.PersistentFlags().StringVar(&result.container, "container", "", "Azure storage container to publish to")
+	cobraCmd.PersistentFlags().StringVar(&result.prefix, "prefix", "staging", "blob name prefix for artifacts from release branches")
+	cobraCmd.PersistentFlags().StringVar(&result.snapshotPrefix, "snapshot-prefix", "snapshot", "blob name prefix for artifacts from other branches. The branch name is appended")
+
+	return finalize(result)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+type publishToGcsCmd struct {
+	baseCommand
+	bucket         string
+	prefix         string
+	snapshotPrefix string
+}
+
+func (cmd *publishToGcsCmd) execute() {
+	if cmd.bucket == "" {
+		cmd.failf("no gcs bucket provided\n")
+	}
+
+	// gcloud doesn't use application default credentials on its own, so point it at the same credentials file
+	if credentialsFile, found := os.LookupEnv("GOOGLE_APPLICATION_CREDENTIALS"); found {
+		if _, overridden := os.LookupEnv("CLOUDSDK_AUTH_CREDENTIAL_FILE_OVERRIDE"); !overridden {
+			if err := os.Setenv("CLOUDSDK_AUTH_CREDENTIAL_FILE_OVERRIDE", credentialsFile); err != nil {
+				cmd.failf("unable to set gcloud credentials file. err: %v\n", err)
+			}
+		}
+	}
+
+	cmd.evalCurrentAndNextVersion()
+
+	artifacts := cmd.collectArtifacts(cmd.getReleaseDir())
+	version := cmd.getArtifactVersion()
+
+	for _, artifact := range artifacts {
+		dest := cmd.getGcsDest(artifact, version)
+		cmd.runCommand(fmt.Sprintf("Publish artifact for %v", artifact.name), "gcloud", "storage", "cp", artifact.artifactPath, dest)
+		for _, checksumPath := range artifact.checksumPaths {
+			cmd.runCommand(fmt.Sprintf("Publish checksum for %v", artifact.name), "gcloud", "storage", "cp", checksumPath, dest+filepath.Ext(checksumPath))
+		}
+	}
+
+	cmd.summaryf("successfully published %v artifacts to gcs bucket %v\n", len(artifacts), cmd.bucket)
+}
+
+func (cmd *publishToGcsCmd) getGcsDest(artifact *artifact, version string) string {
+	prefix := cmd.prefix
+	if !cmd.isReleaseBranch() {
+		prefix = cmd.snapshotPrefix
+	}
+	return fmt.Sprintf("gs://%v/%v/%v", cmd.bucket, prefix, cmd.getArtifactSubPath(artifact, version))
+}
+
+func newPublishToGcsCmd(root *rootCommand) *cobra.Command {
+	cobraCmd := &cobra.Command{
+		Use:   "publish-to-gcs",
+		Short: "Publishes artifacts to a Google Cloud Storage bucket, using application default credentials",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	result := &publishToGcsCmd{
+		baseCommand: baseCommand{
+			rootCommand: root,
+			cmd:         cobraCmd,
+		},
+	}
+
+	result.addReleaseFlags()
+
+	cobraCmd.PersistentFlags().StringVar(&result.bucket, "bucket", "", "GCS bucket to publish to")
+	cobraCmd.PersistentFlags().StringVar(&result.prefix, "prefix", "staging", "object prefix for artifacts from release branches")
+	cobraCmd.PersistentFlags().StringVar(&result.snapshotPrefix, "snapshot-prefix", "snapshot", "object prefix for artifacts from other branches. The branch name is appended")
+
+	return finalize(result)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type publishToGithubCmd struct {
+	baseCommand
+	githubToken string
+	repoOwner   string
+	repoName    string
+}
+
+type githubRelease struct {
+	Id        int64  `json:"id"`
+	TagName   string `json:"tag_name"`
+	UploadUrl string `json:"upload_url"`
+}
+
+func (cmd *publishToGithubCmd) execute() {
+	var found bool
+	cmd.githubToken, found = os.LookupEnv("GITHUB_TOKEN")
+	if !found {
+		cmd.failf("GITHUB_TOKEN not specified\n")
+	}
+
+	if cmd.repoOwner == "" || cmd.repoName == "" {
+		if repoSlug, ok := os.LookupEnv("TRAVIS_REPO_SLUG"); ok && strings.Contains(repoSlug, "/") {
+			parts := strings.SplitN(repoSlug, "/", 2)
+			if cmd.repoOwner == "" {
+				cmd.repoOwner = parts[0]
+			}
+			if cmd.repoName == "" {
+				cmd.repoName = parts[1]
+			}
+		}
+	}
+
+	if cmd.repoOwner == "" || cmd.repoName == "" {
+		cmd.failf("github repository owner and name must be provided\n")
+	}
+
+	cmd.evalCurrentAndNextVersion()
+
+	// a release creates its tag on the remote. A snapshot build tagged with the version it is building towards would
+	// stop the tag command tagging the real release, so only release branches and prereleases are published
+	if !cmd.isReleaseBranch() && cmd.prerelease == "" {
+		cmd.infof("not publishing to github from non-release branch %v without --prerelease\n", cmd.getCurrentBranch())
+		return
+	}
+
+	releaseDir := cmd.getReleaseDir()
+
+	artifacts := cmd.collectArtifacts(releaseDir)
+
+	tagVersion := cmd.getTagName(cmd.getPublishVersion().String())
+	client := resty.New()
+
+	release := cmd.getOrCreateRelease(client, tagVersion)
+
+	for _, artifact := range artifacts {
+		assetName := fmt.Sprintf("%v-%v-%v%v", artifact.name, artifact.os, artifact.arch, cmd.artifactArchiveExtension(artifact.os))
+		cmd.uploadAsset(client, release, artifact.artifactPath, assetName)
+	}
+
+	cmd.summaryf("successfully published %v artifacts to github release %v of %v/%v\n", len(artifacts), tagVersion, cmd.repoOwner, cmd.repoName)
+}
+
+func (cmd *publishToGithubCmd) getOrCreateRelease(client *resty.Client, tagVersion string) *githubRelease {
+	release := &githubRelease{}
+	releaseUrl := fmt.Sprintf("https://api.github.com/repos/%v/%v/releases/tags/%v", cmd.repoOwner, cmd.repoName, url.PathEscape(tagVersion))
+
+	resp, err := cmd.newGithubRequest(client).SetResult(release).Get(releaseUrl)
+	if err != nil {
+		cmd.failf("error looking up github release %v: %v\n", tagVersion, err)
+	}
+
+	if resp.StatusCode() == http.StatusOK {
+		cmd.infof("found existing github release %v\n", tagVersion)
+		return release
+	}
+
+	if resp.StatusCode() != http.StatusNotFound {
+		cmd.logJson(resp.Body())
+		cmd.failf("error looking up github release %v. REST call returned %v\n", tagVersion, resp.StatusCode())
+	}
+
+	body := map[string]interface{}{
+		"tag_name":         tagVersion,
+		"target_commitish": cmd.getCmdOutputOneLine("get git SHA", "git", "rev-parse", "HEAD"),
+		"name":             tagVersion,
+		"prerelease":       !cmd.isReleaseBranch() || cmd.prerelease != "",
+	}
+
+	if cmd.dryRun {
+		cmd.infof("dry run: would create github release %v\n", tagVersion)
+		return release
+	}
+
+	createUrl := fmt.Sprintf("https://api.github.com/repos/%v/%v/releases", cmd.repoOwner, cmd.repoName)
+	resp, err = cmd.newGithubRequest(client).SetBody(body).SetResult(release).Post(createUrl)
+	if err != nil {
+		cmd.failf("error creating github release %v: %v\n", tagVersion, err)
+	}
+
+	if resp.StatusCode() != http.StatusCreated {
+		cmd.logJson(resp.Body())
+		cmd.failf("error creating github release %v. REST call returned %v\n", tagVersion, resp.StatusCode())
+	}
+
+	cmd.infof("created github release %v\n", tagVersion)
+	return release
+}
+
+func (cmd *publishToGithubCmd) uploadAsset(client *resty.Client, release *githubRelease, filePath string, assetName string) {
+	cmd.infof("uploading github release asset: %v -> %v\n", filePath, assetName)
+	if cmd.dryRun {
+		return
+	}
+
+	contents, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		cmd.failf("unable to read release asset %v. err: %v\n", filePath, err)
+	}
+
+	uploadUrl := fmt.Sprintf("https://uploads.github.com/repos/%v/%v/releases/%v/assets", cmd.repoOwner, cmd.repoName, release.Id)
+	resp, err := cmd.newGithubRequest(client).
+		SetHeader("Content-Type", cmd.artifactContentType(assetName)).
+		SetQueryParam("name", assetName).
+		SetBody(contents).
+		Post(uploadUrl)
+
+	if err != nil {
+		cmd.failf("error uploading github release asset %v: %v\n", assetName, err)
+	}
+
+	if resp.StatusCode() != http.StatusCreated {
+		cmd.logJson(resp.Body())
+		cmd.failf("error uploading github release asset %v. REST call returned %v\n", assetName, resp.StatusCode())
+	}
+}
+
+func (cmd *publishToGithubCmd) newGithubRequest(client *resty.Client) *resty.Request {
+	return client.R().
+		SetHeader("Accept", "application/vnd.github.v3+json").
+		SetHeader("Authorization", fmt.Sprintf("token %v", cmd.githubToken))
+}
+
+func newPublishToGithubCmd(root *rootCommand) *cobra.Command {
+	cobraCmd := &cobra.Command{
+		Use:   "publish-to-github",
+		Short: "Publishes artifacts to a GitHub release",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	result := &publishToGithubCmd{
+		baseCommand: baseCommand{
+			rootCommand: root,
+			cmd:         cobraCmd,
+		},
+	}
+
+	result.addReleaseFlags()
+
+	cobraCmd.PersistentFlags().StringVar(&result.repoOwner, "repo-owner", "", "GitHub repository owner. Defaults to owner from TRAVIS_REPO_SLUG")
+	cobraCmd.PersistentFlags().StringVar(&result.repoName, "repo-name", "", "GitHub repository name. Defaults to name from TRAVIS_REPO_SLUG")
+
+	return finalize(result)
+}
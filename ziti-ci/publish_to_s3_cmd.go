@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type publishToS3Cmd struct {
+	baseCommand
+	bucket         string
+	prefix         string
+	snapshotPrefix string
+	publishLatest  bool
+
+	cloudfrontDistribution string
+}
+
+func (cmd *publishToS3Cmd) execute() {
+	if cmd.bucket == "" {
+		cmd.failf("no s3 bucket provided\n")
+	}
+	if cmd.cloudfrontDistribution != "" && !cmd.publishLatest {
+		cmd.failf("--cloudfront-distribution only invalidates latest paths, so requires --publish-latest\n")
+	}
+	cmd.requireAws()
+
+	cmd.evalCurrentAndNextVersion()
+
+	artifacts := cmd.collectArtifacts(cmd.getReleaseDir())
+	version := cmd.getArtifactVersion()
+
+	for _, artifact := range artifacts {
+		dest := cmd.getS3Url(cmd.getS3Key(artifact, version))
+		cmd.runCommand(fmt.Sprintf("Publish artifact for %v", artifact.name), "aws", "s3", "cp", artifact.artifactPath, dest)
+		for _, checksumPath := range artifact.checksumPaths {
+			cmd.runCommand(fmt.Sprintf("Publish checksum for %v", artifact.name), "aws", "s3", "cp", checksumPath, dest+filepath.Ext(checksumPath))
+		}
+	}
+
+	if cmd.publishLatest {
+		cmd.copyToLatest(artifacts, version)
+	}
+
+	cmd.summaryf("successfully published %v artifacts to s3 bucket %v\n", len(artifacts), cmd.bucket)
+}
+
+// copyToLatest copies the release artifacts to the latest path, then invalidates the copied paths in cloudfront, so
+// the new release is served straight away
+func (cmd *publishToS3Cmd) copyToLatest(artifacts []*artifact, version string) {
+	if !cmd.isReleaseBranch() || cmd.getPublishVersion().Prerelease() != "" {
+		cmd.infof("version %v is not a release, so not updating latest\n", version)
+		return
+	}
+
+	var latestPaths []string
+	for _, artifact := range artifacts {
+		key := cmd.getS3Key(artifact, version)
+		latestKey := cmd.getS3Key(artifact, "latest")
+
+		suffixes := []string{""}
+		for _, checksumPath := range artifact.checksumPaths {
+			suffixes = append(suffixes, filepath.Ext(checksumPath))
+		}
+
+		for _, suffix := range suffixes {
+			cmd.runCommand("Copy to latest "+key+suffix, "aws", "s3", "cp", cmd.getS3Url(key+suffix), cmd.getS3Url(latestKey+suffix))
+			latestPaths = append(latestPaths, "/"+latestKey+suffix)
+		}
+	}
+
+	if cmd.cloudfrontDistribution != "" && len(latestPaths) > 0 {
+		params := []string{"cloudfront", "create-invalidation", "--distribution-id", cmd.cloudfrontDistribution, "--paths"}
+		cmd.runCommand("Invalidate latest paths in cloudfront", "aws", append(params, latestPaths...)...)
+		cmd.infof("invalidated %v latest paths in cloudfront distribution %v\n", len(latestPaths), cmd.cloudfrontDistribution)
+	}
+}
+
+// getS3Key returns the object key an artifact is published to, relative to the root of the bucket
+func (cmd *publishToS3Cmd) getS3Key(artifact *artifact, version string) string {
+	prefix := cmd.prefix
+	if !cmd.isReleaseBranch() {
+		prefix = cmd.snapshotPrefix
+	}
+	// an empty prefix publishes to the root of the bucket, rather than under an empty path segment
+	if prefix = strings.Trim(prefix, "/"); prefix == "" {
+		return cmd.getArtifactSubPath(artifact, version)
+	}
+	return fmt.Sprintf("%v/%v", prefix, cmd.getArtifactSubPath(artifact, version))
+}
+
+func (cmd *publishToS3Cmd) getS3Url(key string) string {
+	return fmt.Sprintf("s3://%v/%v", cmd.bucket, key)
+}
+
+// requireAws fails straight away if the aws cli is missing, rather than after the artifacts have been packaged
+func (cmd *publishToS3Cmd) requireAws() {
+	if _, err := exec.LookPath("aws"); err != nil {
+		cmd.failf("publishing to s3 requires the aws cli, but aws was not found on the PATH\n")
+	}
+}
+
+func newPublishToS3Cmd(root *rootCommand) *cobra.Command {
+	cobraCmd := &cobra.Command{
+		Use:   "publish-to-s3",
+		Short: "Publishes artifacts to an S3 bucket",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	result := &publishToS3Cmd{
+		baseCommand: baseCommand{
+			rootCommand: root,
+			cmd:         cobraCmd,
+		},
+	}
+
+	result.addReleaseFlags()
+
+	cobraCmd.PersistentFlags().StringVar(&result.bucket, "bucket", "", "S3 bucket to publish to")
+	cobraCmd.PersistentFlags().StringVar(&result.prefix, "prefix", "staging", "key prefix for artifacts from release branches. May be empty to publish to the root of the bucket")
+	cobraCmd.PersistentFlags().StringVar(&result.snapshotPrefix, "snapshot-prefix", "snapshot", "key prefix for artifacts from other branches. The branch name is appended")
+	cobraCmd.PersistentFlags().BoolVar(&result.publishLatest, "publish-latest", false, "also copy release artifacts to a latest path, in place of the version, replacing the previous release")
+	cobraCmd.PersistentFlags().StringVar(&result.cloudfrontDistribution, "cloudfront-distribution", "", "invalidate the updated latest paths in the given CloudFront distribution. Requires --publish-latest")
+
+	return finalize(result)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/spf13/cobra"
+	"time"
 )
 
 type langType int
@@ -10,17 +11,58 @@ const (
 	LangGo langType = 1
 )
 
+const (
+	DefaultReleaseBranchPattern = "^master$"
+)
+
+const (
+	VersionSourceGit         = "git"
+	VersionSourceFile        = "file"
+	DefaultVersionSourceFile = "./VERSION"
+)
+
+const (
+	VersionSchemeSemVer = "semver"
+	VersionSchemeCalVer = "calver"
+)
+
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+	CompressionXz   = "xz"
+)
+
 type rootCommand struct {
 	rootCobraCmd *cobra.Command
 
-	verbose bool
-	dryRun  bool
+	configFile string
+
+	verbose   bool
+	quiet     bool
+	dryRun    bool
+	logFormat string
+	timeout   time.Duration
 
 	langName string
 	lang     langType
 
 	baseVersionString string
 	baseVersionFile   string
+	versionScheme     string
+	versionPrefix     string
+	prerelease        string
+	versionOverride   string
+	versionSource     string
+	versionSourceFile string
+
+	buildNumberOverride  string
+	releaseBranchPattern string
+
+	compression         string
+	compressionLevel    int
+	parallelCompression bool
+
+	gitRetries int
 }
 
 func newRootCommand() *rootCommand {
@@ -33,12 +75,31 @@ func newRootCommand() *rootCommand {
 		rootCobraCmd: cobraCmd,
 	}
 
-	cobraCmd.PersistentFlags().BoolVarP(&rootCmd.verbose, "verbose", "v", false, "enable verbose output")
+	cobraCmd.PersistentFlags().StringVar(&rootCmd.configFile, "config", DefaultConfigFile, "set the config file location. Keys in the config file are flag names, and flags given on the command line take precedence")
+	cobraCmd.PersistentFlags().BoolVarP(&rootCmd.verbose, "verbose", "v", false, "enable verbose output, including the prefixed output of external commands and jfrog-cli debug logging")
+	cobraCmd.PersistentFlags().BoolVarP(&rootCmd.quiet, "quiet", "q", false, "only output warnings, errors and the final summary")
 	cobraCmd.PersistentFlags().BoolVarP(&rootCmd.dryRun, "dry-run", "d", false, "do a dry run")
+	cobraCmd.PersistentFlags().DurationVar(&rootCmd.timeout, "timeout", 0, "fail if the command doesn't complete within the given duration, killing any running subprocesses. 0 means no timeout")
+	cobraCmd.PersistentFlags().StringVar(&rootCmd.logFormat, "log-format", LogFormatText, "set the log output format. Valid values: [text, json]")
 	cobraCmd.PersistentFlags().StringVarP(&rootCmd.langName, "language", "l", "go", "enable language specific settings. Valid values: [go]")
 
 	cobraCmd.PersistentFlags().StringVarP(&rootCmd.baseVersionString, "base-version", "b", "", "set base version")
 	cobraCmd.PersistentFlags().StringVarP(&rootCmd.baseVersionFile, "base-version-file", "f", DefaultVersionFile, "set base version file location")
+	cobraCmd.PersistentFlags().StringVar(&rootCmd.versionPrefix, "version-prefix", "v", "set the prefix used when rendering versions as tag and release names. May be empty")
+	cobraCmd.PersistentFlags().StringVar(&rootCmd.prerelease, "prerelease", "", "publish the next version as a prerelease with the given identifier, e.g. rc gives 1.3.0-rc.<build number>")
+	cobraCmd.PersistentFlags().StringVar(&rootCmd.versionOverride, "version-override", "", "publish using exactly the given version, instead of computing it from git tags")
+	cobraCmd.PersistentFlags().StringVar(&rootCmd.versionSource, "version-source", VersionSourceGit, "set where the version comes from. git computes it from tags, file reads it from --version-source-file. Valid values: [git, file]")
+	cobraCmd.PersistentFlags().StringVar(&rootCmd.versionSourceFile, "version-source-file", DefaultVersionSourceFile, "set the file the version is read from when using the file version source")
+	cobraCmd.PersistentFlags().StringVar(&rootCmd.versionScheme, "version-scheme", VersionSchemeSemVer, "set the versioning scheme. Valid values: [semver, calver]")
+
+	cobraCmd.PersistentFlags().StringVar(&rootCmd.releaseBranchPattern, "release-branch-pattern", DefaultReleaseBranchPattern, "set the regex matching the branches releases are published from")
+	cobraCmd.PersistentFlags().StringVar(&rootCmd.buildNumberOverride, "build-number", "", "set the build number, instead of taking it from the CI environment")
+
+	cobraCmd.PersistentFlags().StringVar(&rootCmd.compression, "compression", CompressionGzip, "set the archive compression. Valid values: [gzip, zstd, xz]. xz gives the smallest archives, but is slow, so is best kept for release builds")
+	cobraCmd.PersistentFlags().IntVar(&rootCmd.compressionLevel, "compression-level", 0, "set the gzip compression level, from 1 (fastest) to 9 (smallest). Defaults to 6 for release branches and 1 otherwise. Not supported with zstd or xz")
+	cobraCmd.PersistentFlags().BoolVar(&rootCmd.parallelCompression, "parallel-compression", false, "compress gzip archives using GOMAXPROCS parallel workers. The output is still a standard gzip stream")
+
+	cobraCmd.PersistentFlags().IntVar(&rootCmd.gitRetries, "git-retries", 3, "number of times to retry a git push which failed with a network error. Other failures, such as rejected pushes, are not retried")
 
 	return rootCmd
 }
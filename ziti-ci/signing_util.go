@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	GpgSigningKeyEnvVar = "GPG_SIGNING_KEY"
+	AwsKmsKeyScheme     = "awskms://"
+)
+
+// newGpgHome creates a temporary gpg home directory and imports the base64 encoded, armored private key found in the
+// GPG_SIGNING_KEY env var into it. The caller is responsible for removing the directory
+func (cmd *baseCommand) newGpgHome() string {
+	encodedKey, found := os.LookupEnv(GpgSigningKeyEnvVar)
+	if !found || encodedKey == "" {
+		cmd.failf("signing requested, but no signing key found in env var %v\n", GpgSigningKeyEnvVar)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		cmd.failf("unable to decode gpg signing key. err: %v\n", err)
+	}
+
+	gpgHome, err := ioutil.TempDir("", "ziti-ci-gpg")
+	if err != nil {
+		cmd.failf("unable to create temporary gpg home directory. err: %v\n", err)
+	}
+
+	keyFile := filepath.Join(gpgHome, "signing-key.asc")
+	if err = ioutil.WriteFile(keyFile, key, 0600); err != nil {
+		cmd.failf("unable to write gpg signing key file %v. err: %v\n", keyFile, err)
+	}
+
+	cmd.runCommand("import gpg signing key", "gpg", "--homedir", gpgHome, "--batch", "--import", keyFile)
+	return gpgHome
+}
+
+// newGpgVerifyHome creates a temporary gpg home directory and imports the given armored public key into it, for
+// verifying signatures. The caller is responsible for removing the directory
+func (cmd *baseCommand) newGpgVerifyHome(publicKeyFile string) string {
+	gpgHome, err := ioutil.TempDir("", "ziti-ci-gpg")
+	if err != nil {
+		cmd.failf("unable to create temporary gpg home directory. err: %v\n", err)
+	}
+	cmd.runCommand("import gpg public key", "gpg", "--homedir", gpgHome, "--batch", "--import", publicKeyFile)
+	return gpgHome
+}
+
+// gpgSign creates an armored, detached signature for the given file and returns the path to the signature
+func (cmd *baseCommand) gpgSign(gpgHome string, filePath string) string {
+	signaturePath := filePath + ".asc"
+	cmd.runCommand("sign "+filePath, "gpg", "--homedir", gpgHome, "--batch", "--yes",
+		"--detach-sign", "--armor", "--output", signaturePath, filePath)
+	return signaturePath
+}
+
+func (cmd *baseCommand) requireCosign() {
+	if _, err := exec.LookPath("cosign"); err != nil {
+		cmd.failf("cosign signing requested, but cosign was not found on the PATH\n")
+	}
+}
+
+// cosignSignBlob creates a keyless sigstore signature for the given file, using the ambient OIDC identity of the CI
+// job. It returns the paths to the signature and the signing certificate
+func (cmd *baseCommand) cosignSignBlob(filePath string) (string, string) {
+	signaturePath := filePath + ".sig"
+	certPath := filePath + ".pem"
+	cmd.runCommand("cosign "+filePath, "cosign", "sign-blob", "--yes",
+		"--output-signature", signaturePath, "--output-certificate", certPath, filePath)
+	return signaturePath, certPath
+}
+
+// cosignSignBlobWithKms creates a signature for the given file using the given AWS KMS key, so the private key never
+// leaves KMS. Key ids, ARNs and aliases are accepted, as well as full awskms:// key references. It returns the path to
+// the signature
+func (cmd *baseCommand) cosignSignBlobWithKms(kmsKeyId string, filePath string) string {
+	keyRef := kmsKeyId
+	if !strings.HasPrefix(keyRef, AwsKmsKeyScheme) {
+		keyRef = AwsKmsKeyScheme + "/" + kmsKeyId
+	}
+	signaturePath := filePath + ".sig"
+	cmd.runCommand("cosign "+filePath+" with kms key", "cosign", "sign-blob", "--yes", "--key", keyRef,
+		"--output-signature", signaturePath, filePath)
+	return signaturePath
+}
@@ -5,15 +5,29 @@ import (
 	"github.com/spf13/cobra"
 	"os"
 	"strings"
+	"text/template"
 )
 
 const (
 	DefaultVersionFile = "./version"
+
+	DefaultTagMessageTemplate = "Release {{.Version}} (build {{.BuildNumber}})"
 )
 
 type tagCmd struct {
 	baseCommand
-	onlyForBranch string
+	onlyForBranch      string
+	noPush             bool
+	tagMessageTemplate string
+}
+
+// tagMessageInfo holds the fields available to --tag-message-template. Version is rendered with the version prefix,
+// so is the same as the tag name
+type tagMessageInfo struct {
+	Version     string
+	BuildNumber string
+	Branch      string
+	Commit      string
 }
 
 func (cmd *tagCmd) execute() {
@@ -21,6 +35,12 @@ func (cmd *tagCmd) execute() {
 		cmd.infof("current branch %v doesn't match requested branch %v, so skipping\n", cmd.getCurrentBranch(), cmd.onlyForBranch)
 		os.Exit(0)
 	}
+
+	if !cmd.isReleaseBranch() {
+		cmd.failf("releases may only be tagged from a release branch. current branch: %v\n", cmd.getCurrentBranch())
+	}
+
+	cmd.requireCleanTree()
 	cmd.evalCurrentAndNextVersion()
 
 	headTags := cmd.getVersionList("tag", "--points-at", "HEAD")
@@ -31,7 +51,7 @@ func (cmd *tagCmd) execute() {
 
 	cmd.infof("previous version: %v, next version: %v\n", cmd.currentVersion, cmd.nextVersion)
 
-	if cmd.isGoLang() {
+	if cmd.isGoLang() && !cmd.isCalVer() {
 		nextMajorVersion := cmd.nextVersion.Segments()[0]
 		if nextMajorVersion > 1 {
 			moduleName := cmd.getModule()
@@ -41,13 +61,38 @@ func (cmd *tagCmd) execute() {
 		}
 	}
 
-	tagVersion := fmt.Sprintf("%v", cmd.nextVersion)
-	if cmd.isGoLang() {
-		tagVersion = "v" + tagVersion
-	}
-	tagParms := []string{"tag", "-a", tagVersion, "-m", fmt.Sprintf("Release %v", tagVersion)}
+	tagVersion := cmd.getTagName(cmd.nextVersion.String())
+	tagParms := []string{"tag", "-a", tagVersion, "-m", cmd.getTagMessage(tagVersion)}
 	cmd.runGitCommand("create tag", tagParms...)
-	cmd.runGitCommand("push tag to repo", "push", "origin", tagVersion)
+
+	if cmd.noPush {
+		cmd.infof("not pushing tag %v, as requested\n", tagVersion)
+		return
+	}
+	cmd.runGitPush("push tag to repo", "push", "origin", tagVersion)
+}
+
+func (cmd *tagCmd) getTagMessage(tagVersion string) string {
+	compiledTemplate, err := template.New("tag-message").Parse(cmd.tagMessageTemplate)
+	if err != nil {
+		cmd.failf("failure compiling tag message template %+v\n", err)
+	}
+
+	info := &tagMessageInfo{
+		Version:     tagVersion,
+		BuildNumber: cmd.getBuildNumber(),
+		Branch:      cmd.getCurrentBranch(),
+		Commit:      cmd.getCmdOutputOneLine("get short git SHA", "git", "rev-parse", "--short", "HEAD"),
+	}
+
+	message := &strings.Builder{}
+	if err = compiledTemplate.Execute(message, info); err != nil {
+		cmd.failf("failure executing tag message template. err: %+v\n", err)
+	}
+	if strings.TrimSpace(message.String()) == "" {
+		cmd.failf("tag message template %v produced an empty message\n", cmd.tagMessageTemplate)
+	}
+	return message.String()
 }
 
 func newTagCmd(root *rootCommand) *cobra.Command {
@@ -65,6 +110,10 @@ func newTagCmd(root *rootCommand) *cobra.Command {
 	}
 
 	cobraCmd.PersistentFlags().StringVar(&result.onlyForBranch, "only-for-branch", "", "Only do if branch matches")
+	cobraCmd.PersistentFlags().BoolVar(&result.allowDirty, "allow-dirty", false, "tag even if tracked files have uncommitted changes")
+	cobraCmd.PersistentFlags().StringVar(&result.tagMessageTemplate, "tag-message-template", DefaultTagMessageTemplate,
+		"go template for the tag message. Fields: .Version (the tag name), .BuildNumber, .Branch and .Commit")
+	cobraCmd.PersistentFlags().BoolVar(&result.noPush, "no-push", false, "create the tag locally, but don't push it to origin")
 
 	return finalize(result)
 }
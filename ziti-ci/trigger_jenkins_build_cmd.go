@@ -44,10 +44,7 @@ func (cmd *triggerJenkinsSmokeBuildCmd) execute() {
 
 	client := resty.New()
 
-	version := cmd.getPublishVersion().String()
-	if cmd.getCurrentBranch() != "master" {
-		version = fmt.Sprintf("%v-%v", version, cmd.getBuildNumber())
-	}
+	version := cmd.getArtifactVersion()
 
 	resp, err := client.R().
 		EnableTrace().
@@ -69,7 +66,7 @@ func (cmd *triggerJenkinsSmokeBuildCmd) execute() {
 		cmd.failf("Error triggering build. REST call returned %v", resp.StatusCode())
 	}
 
-	cmd.infof("successfully triggered build of ziti-smoke-test for branch: %v, version: %v\n", cmd.getCurrentBranch(), version)
+	cmd.summaryf("successfully triggered build of ziti-smoke-test for branch: %v, version: %v\n", cmd.getCurrentBranch(), version)
 }
 
 func newTriggerJenkinsBuildCmd(root *rootCommand) *cobra.Command {
@@ -67,7 +67,7 @@ func (cmd *triggerTravisBuidlCmd) execute() {
 		cmd.failf("Error triggering build. REST call returned %v", resp.StatusCode())
 	}
 
-	cmd.infof("successfully triggered build of %v to update to %v\n", cmd.args[0], module)
+	cmd.summaryf("successfully triggered build of %v to update to %v\n", cmd.args[0], module)
 }
 
 func newTriggerTravisBuildCmd(root *rootCommand) *cobra.Command {
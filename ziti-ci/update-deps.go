@@ -86,7 +86,7 @@ func (cmd *completeUpdateGoDepCmd) execute() {
 		cmd.runGitCommand("Checkout actual branch", "checkout", cmd.getCurrentBranch())
 	}
 	cmd.runGitCommand("Merge in changes", "merge", "--ff-only", currentCommit)
-	cmd.runGitCommand("Push to remote", "push")
+	cmd.runGitPush("Push to remote", "push")
 }
 
 func newCompleteUpdateGoDepCmd(root *rootCommand) *cobra.Command {
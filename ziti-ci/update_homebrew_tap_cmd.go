@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+var homebrewFormulaTemplate = `# Code generated by ziti-ci. DO NOT EDIT.
+
+class {{.ClassName}} < Formula
+  desc "{{.Description}}"
+  homepage "{{.Homepage}}"
+  version "{{.Version}}"
+{{- range .Artifacts}}
+
+  if Hardware::CPU.{{if eq .Arch "arm64"}}arm{{else}}intel{{end}}?
+    url "{{.Url}}"
+    sha256 "{{.Sha256}}"
+  end
+{{- end}}
+
+  def install
+    bin.install "{{.Binary}}"
+  end
+
+  test do
+    system "#{bin}/{{.Binary}}", "version"
+  end
+end
+`
+
+type homebrewFormula struct {
+	ClassName   string
+	Description string
+	Homepage    string
+	Version     string
+	Binary      string
+	Artifacts   []*homebrewArtifact
+}
+
+type homebrewArtifact struct {
+	Arch   string
+	Url    string
+	Sha256 string
+}
+
+type updateHomebrewTapCmd struct {
+	baseCommand
+	tapRepo         string
+	formulaName     string
+	formulaTemplate string
+	description     string
+	homepage        string
+	downloadBaseUrl string
+}
+
+func (cmd *updateHomebrewTapCmd) execute() {
+	if cmd.tapRepo == "" {
+		cmd.failf("no homebrew tap repository provided\n")
+	}
+
+	if !cmd.isReleaseBranch() {
+		cmd.infof("current branch %v is not a release branch, so skipping homebrew tap update\n", cmd.getCurrentBranch())
+		return
+	}
+
+	cmd.evalCurrentAndNextVersion()
+	publishVersion := cmd.getPublishVersion()
+	if publishVersion.Prerelease() != "" {
+		cmd.infof("version %v is a prerelease, so skipping homebrew tap update\n", publishVersion)
+		return
+	}
+	version := cmd.getArtifactVersion()
+
+	formula := &homebrewFormula{
+		ClassName:   getFormulaClassName(cmd.formulaName),
+		Description: cmd.description,
+		Homepage:    cmd.homepage,
+		Version:     version,
+		Binary:      cmd.formulaName,
+	}
+
+	for _, artifact := range cmd.collectArtifacts(cmd.getReleaseDir()) {
+		if artifact.os == "darwin" && artifact.name == cmd.formulaName {
+			formula.Artifacts = append(formula.Artifacts, &homebrewArtifact{
+				Arch:   artifact.arch,
+				Url:    cmd.downloadBaseUrl + "/" + cmd.getArtifactSubPath(artifact, version),
+				Sha256: artifact.sha256,
+			})
+		}
+	}
+
+	if len(formula.Artifacts) == 0 {
+		cmd.failf("no darwin artifacts named %v found to publish to homebrew tap\n", cmd.formulaName)
+	}
+
+	tapDir, err := ioutil.TempDir("", "ziti-ci-homebrew-tap")
+	if err != nil {
+		cmd.failf("unable to create temp dir for homebrew tap. err: %v\n", err)
+	}
+	defer func() { _ = os.RemoveAll(tapDir) }()
+
+	cmd.runGitCommandAlways("clone homebrew tap", "clone", "--depth", "1", cmd.tapRepo, tapDir)
+
+	formulaFile := filepath.Join("Formula", cmd.formulaName+".rb")
+	cmd.writeFormula(filepath.Join(tapDir, formulaFile), formula)
+
+	if status := cmd.runCommandWithOutput("check for formula changes", "git", "-C", tapDir, "status", "--porcelain"); len(status) == 0 {
+		cmd.summaryf("homebrew formula %v is already up to date\n", cmd.formulaName)
+		return
+	}
+
+	cmd.runGitCommand("add formula", "-C", tapDir, "add", formulaFile)
+	cmd.runGitCommand("set git username", "-C", tapDir, "config", "user.name", DefaultGitUsername)
+	cmd.runGitCommand("set git email", "-C", tapDir, "config", "user.email", DefaultGitEmail)
+	cmd.runGitCommand("commit formula", "-C", tapDir, "commit", "-m", fmt.Sprintf("Update %v to %v", cmd.formulaName, version))
+	cmd.runGitPush("push formula", "-C", tapDir, "push", "origin", "HEAD")
+
+	cmd.summaryf("updated homebrew formula %v to %v\n", cmd.formulaName, version)
+}
+
+func (cmd *updateHomebrewTapCmd) writeFormula(formulaPath string, formula *homebrewFormula) {
+	templateText := homebrewFormulaTemplate
+	if cmd.formulaTemplate != "" {
+		contents, err := ioutil.ReadFile(cmd.formulaTemplate)
+		if err != nil {
+			cmd.failf("unable to read formula template %v. err: %v\n", cmd.formulaTemplate, err)
+		}
+		templateText = string(contents)
+	}
+
+	compiledTemplate, err := template.New("formula").Parse(templateText)
+	if err != nil {
+		cmd.failf("failure compiling formula template %+v\n", err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(formulaPath), 0755); err != nil {
+		cmd.failf("unable to create formula dir for %v. err: %v\n", formulaPath, err)
+	}
+
+	file, err := os.Create(formulaPath)
+	if err != nil {
+		cmd.failf("failure opening formula file %v. err: %+v\n", formulaPath, err)
+	}
+	defer cmd.close(file, "formula file "+formulaPath)
+
+	if err = compiledTemplate.Execute(file, formula); err != nil {
+		cmd.failf("failure executing formula template to %v. err: %+v\n", formulaPath, err)
+	}
+}
+
+// getFormulaClassName returns the ruby class name homebrew expects for a formula, e.g. ziti-tunnel -> ZitiTunnel
+func getFormulaClassName(formulaName string) string {
+	var result strings.Builder
+	for _, part := range strings.FieldsFunc(formulaName, func(r rune) bool { return r == '-' || r == '_' }) {
+		result.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return result.String()
+}
+
+func newUpdateHomebrewTapCmd(root *rootCommand) *cobra.Command {
+	cobraCmd := &cobra.Command{
+		Use:   "update-homebrew-tap",
+		Short: "Updates the homebrew formula in a tap repository to the released version",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	result := &updateHomebrewTapCmd{
+		baseCommand: baseCommand{
+			rootCommand: root,
+			cmd:         cobraCmd,
+		},
+	}
+
+	result.addReleaseFlags()
+
+	cobraCmd.PersistentFlags().StringVar(&result.tapRepo, "tap-repo", "", "git url of the homebrew tap repository")
+	cobraCmd.PersistentFlags().StringVar(&result.formulaName, "formula", "ziti", "name of the formula, which is also the name of the artifact it installs")
+	cobraCmd.PersistentFlags().StringVar(&result.formulaTemplate, "formula-template", "", "go template file to render the formula from, instead of the default template")
+	cobraCmd.PersistentFlags().StringVar(&result.description, "description", "Ziti command line tools", "formula description")
+	cobraCmd.PersistentFlags().StringVar(&result.homepage, "homepage", "https://github.com/openziti", "formula homepage")
+	cobraCmd.PersistentFlags().StringVar(&result.downloadBaseUrl, "download-base-url", DefaultArtifactoryUrl+"/"+DefaultStagingRepo,
+		"base url release artifacts can be downloaded from")
+
+	return finalize(result)
+}
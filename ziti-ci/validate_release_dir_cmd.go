@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"path/filepath"
+)
+
+type validateReleaseDirCmd struct {
+	artifactoryCommand
+}
+
+func (cmd *validateReleaseDirCmd) execute() {
+	releaseDir := cmd.getReleaseDir()
+	problems := cmd.validateLayout(releaseDir)
+
+	cmd.evalCurrentAndNextVersion()
+	version := cmd.getArtifactVersion()
+
+	artifacts := cmd.findArtifacts(releaseDir)
+	cmd.summaryf("\nplanned artifacts for version %v:\n", version)
+	for _, artifact := range artifacts {
+		cmd.summaryf("  %v/%v %v -> %v\n", artifact.arch, artifact.os, artifact.sourceName, cmd.getArtifactDest(artifact, version))
+	}
+
+	if len(artifacts) == 0 {
+		problems++
+		cmd.errorf("error: no releasable files found in %v\n", releaseDir)
+	}
+
+	if problems > 0 {
+		cmd.failf("release dir %v is not valid, found %v problems\n", releaseDir, problems)
+	}
+	cmd.summaryf("release dir %v is valid, %v artifacts would be published\n", releaseDir, len(artifacts))
+}
+
+// validateLayout checks the <arch>/<os>/<files> layout of the release dir, warning about empty dirs. It returns the
+// number of leaf dirs which have files, but nothing releasable
+func (cmd *validateReleaseDirCmd) validateLayout(releaseDir string) int {
+	problems := 0
+	outputDir := cmd.getOutputDir(releaseDir)
+
+	archDirs, err := ioutil.ReadDir(releaseDir)
+	cmd.exitIfErrf(err, "failed to read releases dir: %v\n", err)
+
+	for _, archDir := range archDirs {
+		if !archDir.IsDir() {
+			continue
+		}
+		archDirPath := filepath.Join(releaseDir, archDir.Name())
+		if archDirPath == outputDir {
+			continue
+		}
+		osDirs, err := ioutil.ReadDir(archDirPath)
+		cmd.exitIfErrf(err, "failed to read arch dir %v: %v\n", archDirPath, err)
+
+		if len(osDirs) == 0 {
+			cmd.errorf("warning: arch dir %v is empty\n", archDir.Name())
+			continue
+		}
+
+		for _, osDir := range osDirs {
+			target := archDir.Name() + "/" + osDir.Name()
+			// findArtifacts warns about these
+			if !osDir.IsDir() {
+				continue
+			}
+
+			osDirPath := filepath.Join(archDirPath, osDir.Name())
+			files, err := ioutil.ReadDir(osDirPath)
+			cmd.exitIfErrf(err, "failed to read os dir %v: %v\n", osDirPath, err)
+
+			if len(files) == 0 {
+				cmd.errorf("warning: target dir %v is empty\n", target)
+			} else if len(cmd.findReleasableFiles(osDirPath)) == 0 {
+				problems++
+				cmd.errorf("error: target dir %v has no releasable files, only generated ones\n", target)
+			}
+		}
+	}
+	return problems
+}
+
+func newValidateReleaseDirCmd(root *rootCommand) *cobra.Command {
+	cobraCmd := &cobra.Command{
+		Use:   "validate-release-dir",
+		Short: "Checks the release dir layout and lists the artifacts which would be published, without publishing anything",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	result := &validateReleaseDirCmd{
+		artifactoryCommand: artifactoryCommand{
+			baseCommand: baseCommand{
+				rootCommand: root,
+				cmd:         cobraCmd,
+			},
+		},
+	}
+
+	result.addArtifactoryFlags()
+	result.addReleaseFlags()
+
+	return finalize(result)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+type verifyArtifactsCmd struct {
+	artifactoryCommand
+
+	verifySignatures bool
+	gpgPublicKey     string
+	cosignPublicKey  string
+	// certificateIdentityRegexp and certificateOidcIssuer verify keyless cosign signatures against the sigstore root
+	certificateIdentityRegexp string
+	certificateOidcIssuer     string
+
+	gpgHome string
+}
+
+func (cmd *verifyArtifactsCmd) execute() {
+	cmd.evalCurrentAndNextVersion()
+
+	cmd.initJfrog()
+	releaseDir := cmd.getReleaseDir()
+
+	if cmd.verifySignatures {
+		keyless := cmd.certificateIdentityRegexp != "" || cmd.certificateOidcIssuer != ""
+		if cmd.gpgPublicKey == "" && cmd.cosignPublicKey == "" && !keyless {
+			cmd.failf("--verify-signatures requires --gpg-public-key, --cosign-public-key, or the sigstore certificate identity and issuer\n")
+		}
+		if keyless && (cmd.certificateIdentityRegexp == "" || cmd.certificateOidcIssuer == "") {
+			cmd.failf("keyless verification requires both --certificate-identity-regexp and --certificate-oidc-issuer\n")
+		}
+		if cmd.cosignPublicKey != "" && keyless {
+			cmd.failf("--cosign-public-key can't be combined with keyless verification\n")
+		}
+		if cmd.cosignPublicKey != "" || keyless {
+			cmd.requireCosign()
+		}
+		if cmd.gpgPublicKey != "" {
+			cmd.gpgHome = cmd.newGpgVerifyHome(cmd.gpgPublicKey)
+			defer func() { _ = os.RemoveAll(cmd.gpgHome) }()
+		}
+	}
+
+	downloadDir, err := ioutil.TempDir("", "ziti-ci-verify")
+	cmd.exitIfErrf(err, "could not create temporary download directory: %v\n", err)
+	defer func() { _ = os.RemoveAll(downloadDir) }()
+
+	version := cmd.getArtifactVersion()
+	artifacts := cmd.findArtifacts(releaseDir)
+
+	failures := 0
+	for idx, artifact := range artifacts {
+		localDir := filepath.Join(downloadDir, fmt.Sprintf("%v", idx))
+		if !cmd.verifyArtifact(artifact.artifactPath, cmd.getArtifactDest(artifact, version), localDir) {
+			failures++
+		}
+	}
+
+	if cmd.isReleaseBranch() {
+		for idx, bundle := range cmd.getBundles(releaseDir, artifacts) {
+			localDir := filepath.Join(downloadDir, fmt.Sprintf("%v-%v", bundle.name, idx))
+			if !cmd.verifyArtifact(bundle.artifactPath, cmd.getBundleDest(bundle, version), localDir) {
+				failures++
+			}
+		}
+	}
+
+	if failures > 0 {
+		cmd.failf("%v artifacts failed verification\n", failures)
+	}
+	cmd.summaryf("all artifacts verified for version %v\n", version)
+}
+
+// verifyArtifact downloads the artifact stored at dest and compares its checksum to the locally built archive. With
+// --verify-signatures the published signatures are also verified
+func (cmd *verifyArtifactsCmd) verifyArtifact(localPath, dest, downloadDir string) bool {
+	if _, err := os.Stat(localPath); err != nil {
+		cmd.errorf("FAIL %v: local archive %v not found\n", dest, localPath)
+		return false
+	}
+
+	if err := cmd.download("Download artifact "+dest, dest, downloadDir); err != nil {
+		cmd.errorf("FAIL %v: download failed: %v\n", dest, err)
+		return false
+	}
+
+	if cmd.dryRun {
+		return true
+	}
+
+	downloadedPath := filepath.Join(downloadDir, path.Base(dest))
+	if _, err := os.Stat(downloadedPath); err != nil {
+		cmd.errorf("FAIL %v: artifact not found in artifactory\n", dest)
+		return false
+	}
+
+	expected := cmd.sha256File(localPath)
+	actual := cmd.sha256File(downloadedPath)
+	if expected != actual {
+		cmd.errorf("FAIL %v: checksum mismatch. expected %v, got %v\n", dest, expected, actual)
+		return false
+	}
+
+	cmd.infof("PASS %v: %v\n", dest, actual)
+
+	if cmd.verifySignatures {
+		return cmd.verifyArtifactSignatures(dest, downloadedPath, downloadDir)
+	}
+	return true
+}
+
+// verifyArtifactSignatures downloads the gpg and cosign signatures published alongside dest and verifies them against
+// the downloaded artifact, using whichever keys were provided
+func (cmd *verifyArtifactsCmd) verifyArtifactSignatures(dest, downloadedPath, downloadDir string) bool {
+	valid := true
+
+	if cmd.gpgHome != "" {
+		if err := cmd.downloadSignature(dest+".asc", downloadDir); err != nil {
+			cmd.errorf("FAIL %v: gpg signature %v\n", dest, err)
+			valid = false
+		} else if err = cmd.tryRunCommand("Verify gpg signature "+dest, "gpg", "--homedir", cmd.gpgHome, "--batch",
+			"--verify", downloadedPath+".asc", downloadedPath); err != nil {
+			cmd.errorf("FAIL %v: invalid gpg signature: %v\n", dest, err)
+			valid = false
+		} else {
+			cmd.infof("PASS %v: valid gpg signature\n", dest)
+		}
+	}
+
+	if cmd.cosignPublicKey == "" && cmd.certificateIdentityRegexp == "" {
+		return valid
+	}
+
+	params := []string{"verify-blob", "--signature", downloadedPath + ".sig"}
+	suffixes := []string{".sig"}
+	if cmd.cosignPublicKey != "" {
+		params = append(params, "--key", cmd.cosignPublicKey)
+	} else {
+		params = append(params, "--certificate", downloadedPath+".pem",
+			"--certificate-identity-regexp", cmd.certificateIdentityRegexp,
+			"--certificate-oidc-issuer", cmd.certificateOidcIssuer)
+		suffixes = append(suffixes, ".pem")
+	}
+
+	for _, suffix := range suffixes {
+		if err := cmd.downloadSignature(dest+suffix, downloadDir); err != nil {
+			cmd.errorf("FAIL %v: cosign %v %v\n", dest, suffix, err)
+			return false
+		}
+	}
+
+	if err := cmd.tryRunCommand("Verify cosign signature "+dest, "cosign", append(params, downloadedPath)...); err != nil {
+		cmd.errorf("FAIL %v: invalid cosign signature: %v\n", dest, err)
+		return false
+	}
+	cmd.infof("PASS %v: valid cosign signature\n", dest)
+	return valid
+}
+
+// downloadSignature downloads the signature or certificate at dest, returning an error if it couldn't be downloaded or
+// isn't published
+func (cmd *verifyArtifactsCmd) downloadSignature(dest, downloadDir string) error {
+	if err := cmd.download("Download signature "+dest, dest, downloadDir); err != nil {
+		return fmt.Errorf("download failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(downloadDir, path.Base(dest))); err != nil && !cmd.dryRun {
+		return fmt.Errorf("not found in artifactory")
+	}
+	return nil
+}
+
+func (cmd *verifyArtifactsCmd) download(description, dest, downloadDir string) error {
+	return cmd.tryRunCommand(description, "jfrog", "rt", "dl", dest, downloadDir+"/",
+		"--flat",
+		cmd.jfrogAuthFlag, cmd.jfrogAuthSecret,
+		"--url", cmd.artifactoryUrl)
+}
+
+func newVerifyArtifactsCmd(root *rootCommand) *cobra.Command {
+	cobraCmd := &cobra.Command{
+		Use:   "verify-artifacts",
+		Short: "Verifies published artifacts match the locally built archives",
+		Args:  cobra.ExactArgs(0),
+	}
+
+	result := &verifyArtifactsCmd{
+		artifactoryCommand: artifactoryCommand{
+			baseCommand: baseCommand{
+				rootCommand: root,
+				cmd:         cobraCmd,
+			},
+		},
+	}
+
+	result.addArtifactoryFlags()
+	result.addReleaseFlags()
+	result.addBundleFlags()
+
+	cobraCmd.PersistentFlags().BoolVar(&result.verifySignatures, "verify-signatures", false, "also download and verify the gpg and cosign signatures published alongside each artifact")
+	cobraCmd.PersistentFlags().StringVar(&result.gpgPublicKey, "gpg-public-key", "", "armored gpg public key file to verify .asc signatures with")
+	cobraCmd.PersistentFlags().StringVar(&result.cosignPublicKey, "cosign-public-key", "", "cosign public key file or key reference, e.g. awskms:///alias/name, to verify .sig signatures with")
+	cobraCmd.PersistentFlags().StringVar(&result.certificateIdentityRegexp, "certificate-identity-regexp", "", "verify keyless cosign signatures against the sigstore root, requiring a signing identity matching this regex")
+	cobraCmd.PersistentFlags().StringVar(&result.certificateOidcIssuer, "certificate-oidc-issuer", "", "verify keyless cosign signatures against the sigstore root, requiring this OIDC issuer")
+
+	return finalize(result)
+}
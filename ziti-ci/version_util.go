@@ -4,6 +4,7 @@ import (
 	"github.com/hashicorp/go-version"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -42,6 +43,31 @@ func newVersion(parts []int) *version.Version {
 	return result
 }
 
+// getCalVersions returns the latest release made on the given day, if any, along with the next release version.
+// The first release of a day is versioned YYYY.MM.DD, subsequent releases on the same day get a fourth, micro,
+// segment appended: YYYY.MM.DD.1, YYYY.MM.DD.2, etc
+func getCalVersions(now time.Time, versions []*version.Version) (*version.Version, *version.Version) {
+	today := []int{now.Year(), int(now.Month()), now.Day()}
+
+	var current *version.Version
+	for _, v := range versions {
+		segments := v.Segments()
+		if len(segments) >= 3 && segments[0] == today[0] && segments[1] == today[1] && segments[2] == today[2] {
+			current = v
+		}
+	}
+
+	if current == nil {
+		return nil, newVersion(today)
+	}
+
+	segments := current.Segments()
+	if len(segments) < 4 {
+		return current, newVersion(append(today, 1))
+	}
+	return current, newVersion(append(today, segments[3]+1))
+}
+
 type versionList []*version.Version
 
 func (list versionList) Len() int {
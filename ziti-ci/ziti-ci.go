@@ -19,6 +19,21 @@ func main() {
 	rootCobraCmd.AddCommand(newTriggerTravisBuildCmd(rootCmd))
 	rootCobraCmd.AddCommand(newPackageCmd(rootCmd))
 	rootCobraCmd.AddCommand(newPublishToArtifactoryCmd(rootCmd))
+	rootCobraCmd.AddCommand(newPublishToGithubCmd(rootCmd))
+	rootCobraCmd.AddCommand(newPublishToS3Cmd(rootCmd))
+	rootCobraCmd.AddCommand(newPublishToAzureCmd(rootCmd))
+	rootCobraCmd.AddCommand(newPublishToGcsCmd(rootCmd))
+	rootCobraCmd.AddCommand(newPublishDockerCmd(rootCmd))
+	rootCobraCmd.AddCommand(newUpdateHomebrewTapCmd(rootCmd))
+	rootCobraCmd.AddCommand(newVerifyArtifactsCmd(rootCmd))
+	rootCobraCmd.AddCommand(newValidateReleaseDirCmd(rootCmd))
+	rootCobraCmd.AddCommand(newPromoteCmd(rootCmd))
+	rootCobraCmd.AddCommand(newPruneSnapshotsCmd(rootCmd))
+	rootCobraCmd.AddCommand(newDeleteVersionCmd(rootCmd))
+	rootCobraCmd.AddCommand(newChangelogCmd(rootCmd))
+	rootCobraCmd.AddCommand(newInfoCmd(rootCmd))
+	rootCobraCmd.AddCommand(newNextVersionCmd(rootCmd))
+	rootCobraCmd.AddCommand(newCurrentVersionCmd(rootCmd))
 
 	var versionCmd = &cobra.Command{
 		Use:   "version",